@@ -0,0 +1,248 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opencensus.io/trace"
+)
+
+// AuditRecord describes a write made through the wrapper. Filters and
+// updates are recorded as their redacted shape, without values.
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	Method    string    `json:"method"`
+	Namespace string    `json:"namespace"`
+	Principal string    `json:"principal,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+
+	Filter    string       `json:"filter,omitempty"`
+	Update    string       `json:"update,omitempty"`
+	Documents int          `json:"documents,omitempty"`
+	Models    []AuditModel `json:"models,omitempty"`
+
+	Inserted int64 `json:"inserted"`
+	Matched  int64 `json:"matched"`
+	Modified int64 `json:"modified"`
+	Upserted int64 `json:"upserted"`
+	Deleted  int64 `json:"deleted"`
+
+	// Outcome is "ok" or "error", in which case ErrorCode and ErrorLabels
+	// hold the server's error code and labels, if any. The error message is
+	// not recorded as it may quote values, such as the key of a duplicate
+	// key error.
+	Outcome     string   `json:"outcome"`
+	ErrorCode   int32    `json:"error_code,omitempty"`
+	ErrorLabels []string `json:"error_labels,omitempty"`
+}
+
+// AuditModel describes a write model of a bulk write, such as
+// "UpdateMany", with the redacted shapes of its filter and update.
+type AuditModel struct {
+	Kind   string `json:"kind"`
+	Filter string `json:"filter,omitempty"`
+	Update string `json:"update,omitempty"`
+}
+
+// AuditSink receives the audit records. WriteAudit is called once the write
+// has completed, concurrently if writes are.
+type AuditSink interface {
+	WriteAudit(rec *AuditRecord) error
+}
+
+// NewJSONLinesAuditSink returns an AuditSink writing each record to w as a
+// line of JSON.
+func NewJSONLinesAuditSink(w io.Writer) AuditSink {
+	return &jsonLinesAuditSink{enc: json.NewEncoder(w)}
+}
+
+type jsonLinesAuditSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *jsonLinesAuditSink) WriteAudit(rec *AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(rec)
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal, the
+// identity the writes made with it are audited under.
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal set by ContextWithPrincipal.
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok
+}
+
+var auditedMethods = map[string]bool{
+	"Collection.InsertOne":         true,
+	"Collection.InsertMany":        true,
+	"Collection.UpdateOne":         true,
+	"Collection.UpdateMany":        true,
+	"Collection.ReplaceOne":        true,
+	"Collection.DeleteOne":         true,
+	"Collection.DeleteMany":        true,
+	"Collection.BulkWrite":         true,
+	"Collection.FindOneAndDelete":  true,
+	"Collection.FindOneAndReplace": true,
+	"Collection.FindOneAndUpdate":  true,
+}
+
+// SetAuditSink makes the collections of the client write an AuditRecord to
+// sink for every insert, update, replace, delete, bulk write and
+// FindOneAnd* call. It must be called before the client is used.
+func (wc *WrappedClient) SetAuditSink(sink AuditSink) {
+	wc.AddInterceptors(AuditInterceptor(sink))
+}
+
+// AuditInterceptor returns the Interceptor behind SetAuditSink, for use with
+// NewCollection. Failures to write a record are logged and do not fail the
+// operation.
+func AuditInterceptor(sink AuditSink) Interceptor {
+	return func(ctx context.Context, op *Operation, invoke Invoker) error {
+		if !auditedMethods[op.ShortMethod()] {
+			return invoke(ctx, op)
+		}
+
+		// The record describes the call as issued, not as restricted to a
+		// tenant.
+		issued := issuedOperation(ctx, op)
+		start := time.Now()
+		err := invoke(ctx, op)
+
+		rec := &AuditRecord{
+			Time:      start,
+			Method:    op.ShortMethod(),
+			Namespace: op.Namespace(),
+			Filter:    redactedShape(issued.Filter),
+			Update:    redactedShape(issued.Update),
+			Documents: len(issued.Documents) + len(issued.Models),
+			Outcome:   "ok",
+		}
+		rec.Principal, _ = PrincipalFromContext(ctx)
+		if span := trace.FromContext(ctx); span != nil {
+			rec.TraceID = span.SpanContext().TraceID.String()
+		}
+		for _, m := range issued.Models {
+			kind, filter, update := writeModelArgs(m)
+			rec.Models = append(rec.Models, AuditModel{Kind: kind, Filter: redactedShape(filter), Update: redactedShape(update)})
+		}
+		if err != nil {
+			rec.Outcome = "error"
+			rec.ErrorCode, rec.ErrorLabels = errorCode(err)
+		}
+		auditCounts(rec, op)
+
+		if werr := sink.WriteAudit(rec); werr != nil {
+			logf(nil, "mongowrapper: writing audit record for %s on %s: %v", rec.Method, rec.Namespace, werr)
+		}
+		return err
+	}
+}
+
+// auditCounts fills the result counts of rec from the result of op, which
+// may be partial or missing when the operation failed.
+func auditCounts(rec *AuditRecord, op *Operation) {
+	switch res := op.Result.(type) {
+	case *mongo.InsertOneResult:
+		if res != nil {
+			rec.Inserted = 1
+		}
+	case *mongo.InsertManyResult:
+		if res != nil {
+			rec.Inserted = int64(len(res.InsertedIDs))
+		}
+	case *mongo.UpdateResult:
+		if res != nil {
+			rec.Matched, rec.Modified, rec.Upserted = res.MatchedCount, res.ModifiedCount, res.UpsertedCount
+		}
+	case *mongo.DeleteResult:
+		if res != nil {
+			rec.Deleted = res.DeletedCount
+		}
+	case *mongo.BulkWriteResult:
+		if res != nil {
+			rec.Inserted, rec.Matched, rec.Modified = res.InsertedCount, res.MatchedCount, res.ModifiedCount
+			rec.Upserted, rec.Deleted = res.UpsertedCount, res.DeletedCount
+		}
+	case *WrappedSingleResult:
+		if res.Err() != nil {
+			return
+		}
+		if op.ShortMethod() == "Collection.FindOneAndDelete" {
+			rec.Deleted = 1
+		} else {
+			rec.Matched = 1
+		}
+	}
+}
+
+// writeModelArgs returns the kind of m, such as "DeleteMany", with its
+// filter and its update or replacement.
+func writeModelArgs(m mongo.WriteModel) (kind string, filter, update interface{}) {
+	switch m := m.(type) {
+	case *mongo.InsertOneModel:
+		return "InsertOne", nil, nil
+	case *mongo.ReplaceOneModel:
+		return "ReplaceOne", m.Filter, m.Replacement
+	case *mongo.UpdateOneModel:
+		return "UpdateOne", m.Filter, m.Update
+	case *mongo.UpdateManyModel:
+		return "UpdateMany", m.Filter, m.Update
+	case *mongo.DeleteOneModel:
+		return "DeleteOne", m.Filter, nil
+	case *mongo.DeleteManyModel:
+		return "DeleteMany", m.Filter, nil
+	}
+	return fmt.Sprintf("%T", m), nil, nil
+}
+
+// errorCode returns the code and labels of the server error err reports,
+// the first one for write errors.
+func errorCode(err error) (int32, []string) {
+	switch err := err.(type) {
+	case mongo.CommandError:
+		return err.Code, err.Labels
+	case mongo.WriteException:
+		if len(err.WriteErrors) > 0 {
+			return int32(err.WriteErrors[0].Code), nil
+		}
+		if err.WriteConcernError != nil {
+			return int32(err.WriteConcernError.Code), nil
+		}
+	case mongo.BulkWriteException:
+		if len(err.WriteErrors) > 0 {
+			return int32(err.WriteErrors[0].Code), nil
+		}
+		if err.WriteConcernError != nil {
+			return int32(err.WriteConcernError.Code), nil
+		}
+	}
+	return 0, nil
+}
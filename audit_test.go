@@ -0,0 +1,117 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestAuditInterceptor(t *testing.T) {
+	var buf bytes.Buffer
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"),
+		mongowrapper.AuditInterceptor(mongowrapper.NewJSONLinesAuditSink(&buf)))
+	ctx := mongowrapper.ContextWithPrincipal(context.Background(), "svc-billing")
+
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 1, "email": "a@example.com"}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 1}); err == nil {
+		t.Fatal("InsertOne: expected a duplicate key error")
+	}
+	if _, err := coll.UpdateOne(ctx, bson.M{"email": "a@example.com"}, bson.M{"$set": bson.M{"plan": "pro"}}); err != nil {
+		t.Fatalf("UpdateOne: %v", err)
+	}
+	if _, err := coll.BulkWrite(ctx, []mongo.WriteModel{
+		mongo.NewDeleteManyModel().SetFilter(bson.M{"plan": "free"}),
+		mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": 1}).SetUpdate(bson.M{"$inc": bson.M{"seats": 1}}),
+	}); err != nil {
+		t.Fatalf("BulkWrite: %v", err)
+	}
+	// Reads are not audited.
+	if err := coll.FindOneWrapped(ctx, bson.M{}).Err(); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+
+	var recs []mongowrapper.AuditRecord
+	log := buf.String()
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec mongowrapper.AuditRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("decoding audit log: %v", err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) != 4 {
+		t.Fatalf("got %d audit records, want 4: %+v", len(recs), recs)
+	}
+
+	if r := recs[0]; r.Method != "Collection.InsertOne" || r.Namespace != "db.users" || r.Principal != "svc-billing" ||
+		r.Inserted != 1 || r.Outcome != "ok" {
+		t.Errorf("first record: got %+v", r)
+	}
+	if r := recs[1]; r.Outcome != "error" || r.ErrorCode != 11000 || r.Inserted != 0 {
+		t.Errorf("failed insert record: got %+v", r)
+	}
+	if strings.Contains(log, "dup key") || strings.Contains(log, "a@example.com") {
+		t.Errorf("audit log discloses values: %s", log)
+	}
+	if r := recs[2]; r.Filter != `{"email":"?"}` || r.Update != `{"$set":{"plan":"?"}}` || r.Matched != 1 || r.Modified != 1 {
+		t.Errorf("update record: got %+v", r)
+	}
+	want := []mongowrapper.AuditModel{
+		{Kind: "DeleteMany", Filter: `{"plan":"?"}`},
+		{Kind: "UpdateOne", Filter: `{"_id":"?"}`, Update: `{"$inc":{"seats":"?"}}`},
+	}
+	if r := recs[3]; !reflect.DeepEqual(r.Models, want) || r.Documents != 2 {
+		t.Errorf("bulk write record: got %+v, want models %+v", r, want)
+	}
+}
+
+func TestAuditUnderTenancy(t *testing.T) {
+	for _, auditFirst := range []bool{true, false} {
+		var buf bytes.Buffer
+		audit := mongowrapper.AuditInterceptor(mongowrapper.NewJSONLinesAuditSink(&buf))
+		tenancy := mongowrapper.TenancyInterceptor("tenant")
+		interceptors := []mongowrapper.Interceptor{tenancy, audit}
+		if auditFirst {
+			interceptors = []mongowrapper.Interceptor{audit, tenancy}
+		}
+		coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), interceptors...)
+		ctx := mongowrapper.ContextWithTenant(context.Background(), "acme")
+		if _, err := coll.DeleteMany(ctx, bson.M{"plan": "free"}); err != nil {
+			t.Fatalf("DeleteMany: %v", err)
+		}
+
+		var rec mongowrapper.AuditRecord
+		if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+			t.Fatalf("decoding audit log: %v", err)
+		}
+		if rec.Filter != `{"plan":"?"}` {
+			t.Errorf("audit first %v: got filter %s, want the filter as issued", auditFirst, rec.Filter)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionBackend is what a WrappedCollection runs its operations against.
+// Collections obtained from a WrappedDatabase use the driver; NewCollection
+// accepts other implementations, such as the in-memory one of the
+// mongowrappertest package, which then get the same spans and metrics.
+type CollectionBackend interface {
+	Name() string
+
+	Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error)
+	Drop(ctx context.Context) error
+	EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error)
+	Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error)
+	FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult
+	FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) SingleResult
+	FindOneAndReplace(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) SingleResult
+	FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResult
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error)
+}
+
+// NewCollection returns a WrappedCollection named after database and the
+// name of b that runs its operations against b, through interceptors. The
+// methods that expose the driver, such as Collection, Database, Clone and
+// Indexes, must not be used on it.
+func NewCollection(database string, b CollectionBackend, interceptors ...Interceptor) *WrappedCollection {
+	return &WrappedCollection{b: b, db: database, cfg: &config{interceptors: interceptors}}
+}
+
+func newDriverCollection(coll *mongo.Collection, cfg *config) *WrappedCollection {
+	db := coll.Database().Name()
+	var b CollectionBackend = driverCollection{coll}
+	if cfg.faultInjector != nil {
+		b = cfg.faultInjector.Wrap(db, b)
+	}
+	return &WrappedCollection{coll: coll, b: b, db: db, cfg: cfg}
+}
+
+// driverCollection adapts *mongo.Collection to CollectionBackend.
+type driverCollection struct {
+	*mongo.Collection
+}
+
+func (dc driverCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error) {
+	cur, err := dc.Collection.Aggregate(ctx, pipeline, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+func (dc driverCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	cur, err := dc.Collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+func (dc driverCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult {
+	return dc.Collection.FindOne(ctx, filter, opts...)
+}
+
+func (dc driverCollection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) SingleResult {
+	return dc.Collection.FindOneAndDelete(ctx, filter, opts...)
+}
+
+func (dc driverCollection) FindOneAndReplace(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) SingleResult {
+	return dc.Collection.FindOneAndReplace(ctx, filter, replacement, opts...)
+}
+
+func (dc driverCollection) FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResult {
+	return dc.Collection.FindOneAndUpdate(ctx, filter, update, opts...)
+}
@@ -0,0 +1,141 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+type attributionKey struct{}
+
+// ContextWithAttribution returns a copy of ctx carrying key, such as a tenant
+// or API client name, that the measures of the calls made with it are tagged
+// with to attribute their cost.
+func ContextWithAttribution(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, attributionKey{}, key)
+}
+
+// AttributionFromContext returns the key set by ContextWithAttribution or,
+// failing that, the tenant set by ContextWithTenant if it is a string. It
+// returns "" if ctx carries neither.
+func AttributionFromContext(ctx context.Context) string {
+	if key, ok := ctx.Value(attributionKey{}).(string); ok {
+		return key
+	}
+	if tenant, ok := ctx.Value(tenantKey{}).(string); ok {
+		return tenant
+	}
+	return ""
+}
+
+// withAttribution returns ctx tagged with its attribution key, if any. A key
+// that is not a valid tag value, such as one longer than 255 bytes, is left
+// out on its own so that the other tags of the measures still apply.
+func withAttribution(ctx context.Context) context.Context {
+	key := AttributionFromContext(ctx)
+	if key == "" {
+		return ctx
+	}
+	if tctx, err := tag.New(ctx, tag.Upsert(keyAttribution, key)); err == nil {
+		return tctx
+	}
+	return ctx
+}
+
+// SetCostAccounting makes the client record, under the attribution key of
+// the context, the documents and bytes the collection operations move in the
+// mongo/client/cost views. It must be called before the client is used.
+func (wc *WrappedClient) SetCostAccounting() {
+	wc.AddInterceptors(CostAccountingInterceptor)
+}
+
+// CostAccountingInterceptor is the Interceptor behind SetCostAccounting, for
+// use with NewCollection. Documents returned by cursors are recorded as they
+// are iterated, for the cursors of the *Wrapped methods only, such as
+// FindWrapped: the driver cursors returned by Find and Aggregate are
+// iterated without the wrapper. Documents matched are those the server reports as matched,
+// deleted or counted, and those returned by reads; the documents it scanned
+// to find them are not reported to the client.
+func CostAccountingInterceptor(ctx context.Context, op *Operation, invoke Invoker) error {
+	if isUninstrumented(ctx) {
+		return invoke(ctx, op)
+	}
+	err := invoke(ctx, op)
+	if op.Collection == "" {
+		return err
+	}
+
+	tctx, _ := tag.New(withAttribution(ctx), tag.Upsert(keyMethod, op.Method), tag.Upsert(keyNamespace, op.Namespace()))
+
+	sent := bsonSize(op.Filter) + bsonSize(op.Update) + bsonSize(op.Pipeline)
+	for _, doc := range op.Documents {
+		sent += bsonSize(doc)
+	}
+	stats.Record(tctx, mBytesSent.M(sent))
+
+	returned := func(n, bytes int64) {
+		stats.Record(tctx, mDocsReturned.M(n), mDocsMatched.M(n), mBytesReturned.M(bytes))
+	}
+	switch res := op.Result.(type) {
+	case *WrappedCursor:
+		if res != nil {
+			res.observeReturned(returned)
+		}
+	case *WrappedSingleResult:
+		if raw, err := res.DecodeBytes(); err == nil {
+			returned(1, int64(len(raw)))
+		}
+	case []interface{}:
+		returned(int64(len(res)), bsonSize(res))
+	case int64:
+		if op.ShortMethod() != "Collection.EstimatedDocumentCount" {
+			stats.Record(tctx, mDocsMatched.M(res))
+		}
+	case *mongo.UpdateResult:
+		if res != nil {
+			stats.Record(tctx, mDocsMatched.M(res.MatchedCount))
+		}
+	case *mongo.DeleteResult:
+		if res != nil {
+			stats.Record(tctx, mDocsMatched.M(res.DeletedCount))
+		}
+	case *mongo.BulkWriteResult:
+		if res != nil {
+			stats.Record(tctx, mDocsMatched.M(res.MatchedCount+res.DeletedCount))
+		}
+	}
+	return err
+}
+
+// bsonSize returns the encoded size of v, or 0 if it is nil or cannot be
+// encoded. Values other than documents are sized as a one-field document.
+func bsonSize(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		raw, err = bson.Marshal(bson.D{{Key: "v", Value: v}})
+	}
+	if err != nil {
+		return 0
+	}
+	return int64(len(raw))
+}
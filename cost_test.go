@@ -0,0 +1,128 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opencensus.io/stats/view"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestCostAccounting(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("orders"),
+		mongowrapper.CostAccountingInterceptor)
+	acme := mongowrapper.ContextWithAttribution(context.Background(), "acme")
+	globex := mongowrapper.ContextWithTenant(context.Background(), "globex")
+
+	docs := []interface{}{bson.M{"_id": 1, "n": 1}, bson.M{"_id": 2, "n": 1}, bson.M{"_id": 3, "n": 2}}
+	if _, err := coll.InsertMany(acme, docs); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	cur, err := coll.FindWrapped(acme, bson.M{"n": 1})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	for cur.Next(acme) {
+	}
+	cur.Close(acme)
+	if _, err := coll.UpdateMany(globex, bson.M{}, bson.M{"$set": bson.M{"seen": true}}); err != nil {
+		t.Fatalf("UpdateMany: %v", err)
+	}
+
+	sums := func(viewName string) map[string]float64 {
+		t.Helper()
+		rows, err := rec.Rows(viewName)
+		if err != nil {
+			t.Fatalf("Rows(%q): %v", viewName, err)
+		}
+		got := make(map[string]float64)
+		for _, row := range rows {
+			for _, tg := range row.Tags {
+				if tg.Key.Name() == "attribution" {
+					got[tg.Value] += row.Data.(*view.SumData).Value
+				}
+			}
+		}
+		return got
+	}
+
+	returned := sums("mongo/client/cost/documents_returned")
+	if returned["acme"] != 2 || returned["globex"] != 0 {
+		t.Errorf("documents returned: got %v", returned)
+	}
+	matched := sums("mongo/client/cost/documents_matched")
+	if matched["acme"] != 2 || matched["globex"] != 3 {
+		t.Errorf("documents matched: got %v", matched)
+	}
+	if b := sums("mongo/client/cost/bytes_returned"); b["acme"] <= 0 {
+		t.Errorf("bytes returned: got %v", b)
+	}
+	if b := sums("mongo/client/cost/bytes_sent"); b["acme"] <= b["globex"] || b["globex"] <= 0 {
+		t.Errorf("bytes sent: got %v", b)
+	}
+
+	rows, err := rec.Rows("mongo/client/cost/calls")
+	if err != nil {
+		t.Fatalf("Rows: %v", err)
+	}
+	calls := make(map[string]int64)
+	for _, row := range rows {
+		for _, tg := range row.Tags {
+			if tg.Key.Name() == "attribution" {
+				calls[tg.Value] += row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	if calls["acme"] != 2 || calls["globex"] != 1 {
+		t.Errorf("calls: got %v", calls)
+	}
+}
+
+func TestCostAccountingInvalidAttribution(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("orders"),
+		mongowrapper.CostAccountingInterceptor)
+	// Too long to be a tag value.
+	ctx := mongowrapper.ContextWithAttribution(context.Background(), strings.Repeat("x", 300))
+	if _, err := coll.CountDocuments(ctx, bson.M{}); err != nil {
+		t.Fatalf("CountDocuments: %v", err)
+	}
+	if n, _ := rec.Calls("Collection.CountDocuments"); n != 1 {
+		t.Errorf("calls with an invalid attribution key: got %d, want 1", n)
+	}
+
+	// Only string tenants are attribution keys.
+	ctx = mongowrapper.ContextWithTenant(context.Background(), 42)
+	if key := mongowrapper.AttributionFromContext(ctx); key != "" {
+		t.Errorf("AttributionFromContext with an int tenant: got %q, want none", key)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// TrackedCursor describes an open cursor created through a WrappedCollection.
+type TrackedCursor struct {
+	// Namespace is the "database.collection" the cursor reads from.
+	Namespace string
+	Created   time.Time
+	LastUsed  time.Time
+	// Stack is the call stack FindWrapped or AggregateWrapped was invoked from.
+	Stack string
+}
+
+// Idle returns how long the cursor has not been iterated.
+func (tc TrackedCursor) Idle() time.Duration { return time.Since(tc.LastUsed) }
+
+// CursorTracker keeps track of the cursors returned by
+// WrappedCollection.FindWrapped and AggregateWrapped until they are closed or exhausted, to find cursors that pin
+// server resources because they are never closed. It is meant as a debug
+// mode; install one with WrappedClient.SetCursorTracker.
+type CursorTracker struct {
+	// Logger, if set, receives a record of every cursor that is garbage
+	// collected without being closed. Otherwise the standard logger is used.
+	Logger *log.Logger
+
+	mu      sync.Mutex
+	open    map[*trackedCursor]bool
+	leaked  []TrackedCursor
+	maxLeak int
+}
+
+// NewCursorTracker returns a CursorTracker that remembers up to maxLeaked
+// cursors that were garbage collected without being closed.
+func NewCursorTracker(maxLeaked int) *CursorTracker {
+	return &CursorTracker{open: make(map[*trackedCursor]bool), maxLeak: maxLeaked}
+}
+
+// trackedCursor is the bookkeeping for one cursor. It must not refer to the
+// cursor itself so that the cursor can be garbage collected.
+type trackedCursor struct {
+	tracker   *CursorTracker
+	namespace string
+	created   time.Time
+	lastUsed  int64 // UnixNano, accessed atomically
+	stack     string
+}
+
+func (tc *trackedCursor) touch() {
+	atomic.StoreInt64(&tc.lastUsed, time.Now().UnixNano())
+}
+
+func (tc *trackedCursor) snapshot() TrackedCursor {
+	return TrackedCursor{
+		Namespace: tc.namespace,
+		Created:   tc.created,
+		LastUsed:  time.Unix(0, atomic.LoadInt64(&tc.lastUsed)),
+		Stack:     tc.stack,
+	}
+}
+
+// wrapCursor wraps cur, tracking it if a tracker is installed.
+func (ct *CursorTracker) wrapCursor(cur Cursor, namespace string) *WrappedCursor {
+	if cur == nil {
+		return &WrappedCursor{}
+	}
+	wcur := NewCursor(cur)
+	if ct == nil || cur.ID() == 0 {
+		// Cursors exhausted by their first batch hold nothing on the server.
+		return wcur
+	}
+
+	now := time.Now()
+	tc := &trackedCursor{tracker: ct, namespace: namespace, created: now, lastUsed: now.UnixNano(), stack: callerStack(2)}
+	wcur.tc = tc
+
+	ct.mu.Lock()
+	ct.open[tc] = true
+	n := len(ct.open)
+	ct.mu.Unlock()
+	stats.Record(context.Background(), mOpenCursors.M(int64(n)))
+
+	runtime.SetFinalizer(wcur, func(wcur *WrappedCursor) { ct.collected(wcur.tc) })
+	return wcur
+}
+
+// untrack forgets tc, reporting whether it was still being tracked.
+func (ct *CursorTracker) untrack(tc *trackedCursor) bool {
+	ct.mu.Lock()
+	tracked := ct.open[tc]
+	delete(ct.open, tc)
+	n := len(ct.open)
+	ct.mu.Unlock()
+
+	if tracked {
+		stats.Record(context.Background(), mOpenCursors.M(int64(n)))
+	}
+	return tracked
+}
+
+func (ct *CursorTracker) collected(tc *trackedCursor) {
+	if !ct.untrack(tc) {
+		return
+	}
+
+	leak := tc.snapshot()
+	ct.mu.Lock()
+	if len(ct.leaked) >= ct.maxLeak && len(ct.leaked) > 0 {
+		ct.leaked = ct.leaked[1:]
+	}
+	if ct.maxLeak > 0 {
+		ct.leaked = append(ct.leaked, leak)
+	}
+	ct.mu.Unlock()
+
+	ctx, _ := tag.New(context.Background(), tag.Upsert(keyNamespace, leak.Namespace))
+	stats.Record(ctx, mLeakedCursors.M(1))
+	logf(ct.Logger, "mongowrapper: cursor on %s garbage collected without Close, created at:\n%s", leak.Namespace, leak.Stack)
+}
+
+// Open returns the cursors that are neither closed nor exhausted, least
+// recently used first.
+func (ct *CursorTracker) Open() []TrackedCursor {
+	return ct.Idle(0)
+}
+
+// Idle returns the open cursors that have not been iterated for longer than
+// threshold, least recently used first.
+func (ct *CursorTracker) Idle(threshold time.Duration) []TrackedCursor {
+	ct.mu.Lock()
+	var tcs []TrackedCursor
+	for tc := range ct.open {
+		if s := tc.snapshot(); s.Idle() >= threshold {
+			tcs = append(tcs, s)
+		}
+	}
+	ct.mu.Unlock()
+
+	sort.Slice(tcs, func(i, j int) bool { return tcs[i].LastUsed.Before(tcs[j].LastUsed) })
+	return tcs
+}
+
+// LogIdle logs the open cursors idle for longer than threshold along with
+// the stack they were created from, returning how many were logged.
+func (ct *CursorTracker) LogIdle(threshold time.Duration) int {
+	tcs := ct.Idle(threshold)
+	for _, tc := range tcs {
+		logf(ct.Logger, "mongowrapper: cursor on %s idle for %s, created at:\n%s", tc.Namespace, tc.Idle(), tc.Stack)
+	}
+	return len(tcs)
+}
+
+// Leaked returns the most recent cursors that were garbage collected without
+// being closed, oldest first.
+func (ct *CursorTracker) Leaked() []TrackedCursor {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+	return append([]TrackedCursor(nil), ct.leaked...)
+}
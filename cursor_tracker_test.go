@@ -0,0 +1,143 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestCursorTracker(t *testing.T) {
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	ct := mongowrapper.NewCursorTracker(4)
+	ct.Logger = log.New(ioutil.Discard, "", 0)
+	client.SetCursorTracker(ct)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	var docs []interface{}
+	for i := 0; i < 5; i++ {
+		docs = append(docs, bson.M{"_id": i})
+	}
+	if _, err := srv.Collection("db", "c").InsertMany(ctx, docs); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	coll := client.Database("db").Collection("c")
+
+	// The driver typed Find is not tracked.
+	raw, err := coll.Find(ctx, bson.D{}, options.Find().SetBatchSize(2))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	defer raw.Close(ctx)
+	if n := len(ct.Open()); n != 0 {
+		t.Errorf("open cursors after Find: got %d, want 0", n)
+	}
+
+	cur, err := coll.FindWrapped(ctx, bson.D{}, options.Find().SetBatchSize(2))
+	if err != nil {
+		t.Fatalf("FindWrapped: %v", err)
+	}
+	open := ct.Open()
+	if len(open) != 1 || open[0].Namespace != "db.c" {
+		t.Fatalf("open cursors: got %+v, want one on db.c", open)
+	}
+	wcur := cur.(*mongowrapper.WrappedCursor)
+	n := 0
+	for cur.Next(ctx) {
+		if id, _ := wcur.Current.Lookup("_id").Int32OK(); int(id) != n {
+			t.Errorf("Current: got _id %d, want %d", id, n)
+		}
+		n++
+	}
+	if n != 5 {
+		t.Errorf("documents: got %d, want 5", n)
+	}
+	if n := len(ct.Open()); n != 0 {
+		t.Errorf("open cursors after exhaustion: got %d, want 0", n)
+	}
+	cur.Close(ctx)
+
+	func() {
+		leak, err := coll.AggregateWrapped(ctx, bson.A{}, options.Aggregate().SetBatchSize(2))
+		if err != nil {
+			t.Fatalf("AggregateWrapped: %v", err)
+		}
+		leak.Next(ctx)
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for len(ct.Leaked()) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	leaked := ct.Leaked()
+	if len(leaked) != 1 || leaked[0].Namespace != "db.c" {
+		t.Errorf("leaked cursors: got %+v, want one on db.c", leaked)
+	}
+	if n := len(ct.Open()); n != 0 {
+		t.Errorf("open cursors after leak: got %d, want 0", n)
+	}
+}
+
+func TestWrappedCursorCurrent(t *testing.T) {
+	ctx := context.Background()
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("c"))
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": "a"}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	cur, err := coll.FindWrapped(ctx, bson.D{})
+	if err != nil {
+		t.Fatalf("FindWrapped: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	wcur := cur.(*mongowrapper.WrappedCursor)
+	if wcur.Cursor != nil {
+		t.Errorf("Cursor: got a driver cursor for the in-memory backend")
+	}
+	if !cur.Next(ctx) {
+		t.Fatalf("Next: %v", cur.Err())
+	}
+	if id, _ := wcur.Current.Lookup("_id").StringValueOK(); id != "a" {
+		t.Errorf("Current: got _id %q, want %q", id, "a")
+	}
+	if n := wcur.RemainingBatchLength(); n != 0 {
+		t.Errorf("RemainingBatchLength: got %d, want 0", n)
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/trace"
+)
+
+// FaultKind is a kind of error a FaultInjector injects.
+type FaultKind int
+
+const (
+	// FaultNone injects no error; the rule only adds latency.
+	FaultNone FaultKind = iota
+	// FaultNetwork is a connection error labelled NetworkError.
+	FaultNetwork
+	// FaultTimeout is a MaxTimeMSExpired server error.
+	FaultTimeout
+	// FaultDuplicateKey is an E11000 duplicate key error, shaped as a
+	// WriteException, a BulkWriteException or a CommandError depending on
+	// the method.
+	FaultDuplicateKey
+	// FaultWriteConflict is a WriteConflict error labelled
+	// TransientTransactionError.
+	FaultWriteConflict
+	// FaultNotPrimary is a NotMaster error, as returned by a primary that
+	// stepped down.
+	FaultNotPrimary
+)
+
+func (fk FaultKind) String() string {
+	switch fk {
+	case FaultNone:
+		return "none"
+	case FaultNetwork:
+		return "network"
+	case FaultTimeout:
+		return "timeout"
+	case FaultDuplicateKey:
+		return "duplicate_key"
+	case FaultWriteConflict:
+		return "write_conflict"
+	case FaultNotPrimary:
+		return "not_primary"
+	}
+	return fmt.Sprintf("FaultKind(%d)", int(fk))
+}
+
+// FaultRule describes a fault and the operations it applies to.
+type FaultRule struct {
+	// Method is the name of the collection method, such as "InsertOne" or
+	// "CountDocuments", which may also be given as "Collection.InsertOne" or
+	// as the full span name; empty matches every method.
+	Method string
+	// Namespace is "db.collection", or "db.*" for every collection of a
+	// database; empty matches every namespace.
+	Namespace string
+
+	Kind FaultKind
+	// Latency is added before the operation runs, or before the error is
+	// returned.
+	Latency time.Duration
+	// Probability is the chance, from 0 to 1, that the rule fires on a
+	// matching operation.
+	Probability float64
+}
+
+func (fr FaultRule) matches(method, namespace string) bool {
+	if fr.Method != "" && strings.TrimPrefix(strings.TrimPrefix(fr.Method, methodPrefix), "Collection.") != method {
+		return false
+	}
+	return fr.Namespace == "" || matchNamespace(fr.Namespace, namespace)
+}
+
+// FaultInjector makes collection operations fail or slow down according to
+// its rules, to exercise retry and fallback code. The first matching rule
+// that fires is applied; injected faults are marked on the operation's span
+// with the mongo.fault_injected attribute, and their error messages say they
+// were injected.
+type FaultInjector struct {
+	mu    sync.Mutex
+	rules []FaultRule
+	rand  *rand.Rand
+}
+
+// NewFaultInjector returns a FaultInjector applying rules, drawing from a
+// random source seeded with seed so that runs can be reproduced.
+func NewFaultInjector(seed int64, rules ...FaultRule) *FaultInjector {
+	return &FaultInjector{rules: rules, rand: rand.New(rand.NewSource(seed))}
+}
+
+// SetRules replaces the rules; it may be called while operations run.
+func (fi *FaultInjector) SetRules(rules ...FaultRule) {
+	fi.mu.Lock()
+	fi.rules = rules
+	fi.mu.Unlock()
+}
+
+// Wrap returns b with the faults injected, for use with NewCollection.
+func (fi *FaultInjector) Wrap(database string, b CollectionBackend) CollectionBackend {
+	return faultyCollection{CollectionBackend: b, fi: fi, db: database}
+}
+
+func (fi *FaultInjector) pick(method, namespace string) (FaultRule, bool) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	for _, rule := range fi.rules {
+		if rule.matches(method, namespace) && fi.rand.Float64() < rule.Probability {
+			return rule, true
+		}
+	}
+	return FaultRule{}, false
+}
+
+// inject applies the fault picked for the operation, if any, and returns the
+// error to fail it with.
+func (fi *FaultInjector) inject(ctx context.Context, method, namespace string) error {
+	rule, ok := fi.pick(method, namespace)
+	if !ok {
+		return nil
+	}
+
+	if span := trace.FromContext(ctx); span != nil {
+		span.AddAttributes(
+			trace.BoolAttribute("mongo.fault_injected", true),
+			trace.StringAttribute("mongo.fault", rule.Kind.String()),
+			trace.Int64Attribute("mongo.fault_latency_ms", int64(rule.Latency/time.Millisecond)),
+		)
+	}
+
+	if rule.Latency > 0 {
+		t := time.NewTimer(rule.Latency)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+	return faultError(rule.Kind, method, namespace)
+}
+
+func faultError(kind FaultKind, method, namespace string) error {
+	switch kind {
+	case FaultNetwork:
+		return mongo.CommandError{
+			Message: "connection closed (injected fault)",
+			Labels:  []string{"NetworkError"},
+		}
+	case FaultTimeout:
+		return mongo.CommandError{
+			Code: 50, Name: "MaxTimeMSExpired",
+			Message: "operation exceeded time limit (injected fault)",
+		}
+	case FaultDuplicateKey:
+		msg := fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_ (injected fault)", namespace)
+		switch method {
+		case "InsertOne", "UpdateOne", "UpdateMany", "ReplaceOne", "DeleteOne", "DeleteMany":
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000, Message: msg}}}
+		case "InsertMany", "BulkWrite":
+			return mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{WriteError: mongo.WriteError{Code: 11000, Message: msg}}}}
+		}
+		return mongo.CommandError{Code: 11000, Name: "DuplicateKey", Message: msg}
+	case FaultWriteConflict:
+		return mongo.CommandError{
+			Code: 112, Name: "WriteConflict",
+			Message: "write conflict (injected fault)",
+			Labels:  []string{"TransientTransactionError"},
+		}
+	case FaultNotPrimary:
+		return mongo.CommandError{
+			Code: 10107, Name: "NotMaster",
+			Message: "not master (injected fault)",
+		}
+	}
+	return nil
+}
+
+// faultyCollection injects faults before delegating to its backend.
+type faultyCollection struct {
+	CollectionBackend
+	fi *FaultInjector
+	db string
+}
+
+func (fc faultyCollection) inject(ctx context.Context, method string) error {
+	return fc.fi.inject(ctx, method, fc.db+"."+fc.Name())
+}
+
+func (fc faultyCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error) {
+	if err := fc.inject(ctx, "Aggregate"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.Aggregate(ctx, pipeline, opts...)
+}
+
+func (fc faultyCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	if err := fc.inject(ctx, "BulkWrite"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.BulkWrite(ctx, models, opts...)
+}
+
+func (fc faultyCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	if err := fc.inject(ctx, "CountDocuments"); err != nil {
+		return 0, err
+	}
+	return fc.CollectionBackend.CountDocuments(ctx, filter, opts...)
+}
+
+func (fc faultyCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	if err := fc.inject(ctx, "DeleteMany"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.DeleteMany(ctx, filter, opts...)
+}
+
+func (fc faultyCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	if err := fc.inject(ctx, "DeleteOne"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.DeleteOne(ctx, filter, opts...)
+}
+
+func (fc faultyCollection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error) {
+	if err := fc.inject(ctx, "Distinct"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.Distinct(ctx, fieldName, filter, opts...)
+}
+
+func (fc faultyCollection) Drop(ctx context.Context) error {
+	if err := fc.inject(ctx, "Drop"); err != nil {
+		return err
+	}
+	return fc.CollectionBackend.Drop(ctx)
+}
+
+func (fc faultyCollection) EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
+	if err := fc.inject(ctx, "EstimatedDocumentCount"); err != nil {
+		return 0, err
+	}
+	return fc.CollectionBackend.EstimatedDocumentCount(ctx, opts...)
+}
+
+func (fc faultyCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	if err := fc.inject(ctx, "Find"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.Find(ctx, filter, opts...)
+}
+
+func (fc faultyCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult {
+	if err := fc.inject(ctx, "FindOne"); err != nil {
+		return errSingleResult{err}
+	}
+	return fc.CollectionBackend.FindOne(ctx, filter, opts...)
+}
+
+func (fc faultyCollection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) SingleResult {
+	if err := fc.inject(ctx, "FindOneAndDelete"); err != nil {
+		return errSingleResult{err}
+	}
+	return fc.CollectionBackend.FindOneAndDelete(ctx, filter, opts...)
+}
+
+func (fc faultyCollection) FindOneAndReplace(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) SingleResult {
+	if err := fc.inject(ctx, "FindOneAndReplace"); err != nil {
+		return errSingleResult{err}
+	}
+	return fc.CollectionBackend.FindOneAndReplace(ctx, filter, replacement, opts...)
+}
+
+func (fc faultyCollection) FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResult {
+	if err := fc.inject(ctx, "FindOneAndUpdate"); err != nil {
+		return errSingleResult{err}
+	}
+	return fc.CollectionBackend.FindOneAndUpdate(ctx, filter, update, opts...)
+}
+
+func (fc faultyCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	if err := fc.inject(ctx, "InsertMany"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.InsertMany(ctx, documents, opts...)
+}
+
+func (fc faultyCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	if err := fc.inject(ctx, "InsertOne"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.InsertOne(ctx, document, opts...)
+}
+
+func (fc faultyCollection) ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	if err := fc.inject(ctx, "ReplaceOne"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.ReplaceOne(ctx, filter, replacement, opts...)
+}
+
+func (fc faultyCollection) UpdateMany(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if err := fc.inject(ctx, "UpdateMany"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.UpdateMany(ctx, filter, update, opts...)
+}
+
+func (fc faultyCollection) UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	if err := fc.inject(ctx, "UpdateOne"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.UpdateOne(ctx, filter, update, opts...)
+}
+
+func (fc faultyCollection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	if err := fc.inject(ctx, "Watch"); err != nil {
+		return nil, err
+	}
+	return fc.CollectionBackend.Watch(ctx, pipeline, opts...)
+}
+
+// errSingleResult is a SingleResult holding only an error.
+type errSingleResult struct{ err error }
+
+func (esr errSingleResult) Decode(interface{}) error       { return esr.err }
+func (esr errSingleResult) DecodeBytes() (bson.Raw, error) { return nil, esr.err }
+func (esr errSingleResult) Err() error                     { return esr.err }
@@ -0,0 +1,76 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opencensus.io/trace"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestFaultInjector(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	fi := mongowrapper.NewFaultInjector(1,
+		mongowrapper.FaultRule{Method: "InsertOne", Namespace: "db.*", Kind: mongowrapper.FaultDuplicateKey, Probability: 1},
+		mongowrapper.FaultRule{Method: "FindOne", Namespace: "db.other", Kind: mongowrapper.FaultNetwork, Probability: 1},
+		mongowrapper.FaultRule{Method: "Collection.CountDocuments", Latency: 20 * time.Millisecond, Probability: 1},
+		mongowrapper.FaultRule{Method: "go.mongodb.org/mongo-driver.Collection.Distinct", Kind: mongowrapper.FaultTimeout, Probability: 1},
+	)
+	coll := mongowrapper.NewCollection("db", fi.Wrap("db", mongowrappertest.NewCollection("music")))
+	ctx := context.Background()
+
+	_, err = coll.InsertOne(ctx, bson.M{"_id": 1})
+	if we, ok := err.(mongo.WriteException); !ok || we.WriteErrors[0].Code != 11000 {
+		t.Fatalf("InsertOne: got %v, want an injected duplicate key error", err)
+	}
+	rec.AssertSpan(t, "Collection.InsertOne", map[string]interface{}{
+		"mongo.fault_injected": true,
+		"mongo.fault":          "duplicate_key",
+	}, trace.StatusCodeUnknown)
+
+	// The FindOne rule is scoped to another collection.
+	if err := coll.FindOneWrapped(ctx, bson.M{}).Err(); err != mongo.ErrNoDocuments {
+		t.Fatalf("FindOne: got %v, want ErrNoDocuments", err)
+	}
+
+	start := time.Now()
+	if _, err := coll.CountDocuments(ctx, bson.M{}); err != nil {
+		t.Fatalf("CountDocuments: %v", err)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("CountDocuments took %v, want at least the injected 20ms", d)
+	}
+
+	if _, err := coll.Distinct(ctx, "name", bson.M{}); err == nil {
+		t.Fatal("Distinct: expected an injected timeout")
+	}
+
+	fi.SetRules()
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 1}); err != nil {
+		t.Fatalf("InsertOne without rules: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opencensus.io/trace"
+)
+
+// Operation describes a call made through the wrapper, as seen by
+// interceptors.
+type Operation struct {
+	// Method is the name of the span of the call, such as
+	// "go.mongodb.org/mongo-driver.Collection.Find".
+	Method string
+	// Database and Collection are the target of the call, when it has one.
+	Database   string
+	Collection string
+
+	// Filter, Update, Documents, Pipeline and Models hold the arguments of
+	// the call that apply to it; an interceptor may replace them before
+	// invoking the call.
+	Filter    interface{}
+	Update    interface{}
+	Documents []interface{}
+	Pipeline  interface{}
+	Models    []mongo.WriteModel
+	// Options holds the options passed to the method, such as a
+	// []*options.FindOptions. Changing it has no effect.
+	Options interface{}
+
+	// Result is set by the call to what the method returns besides the
+	// error, such as a *mongo.InsertOneResult or a *WrappedCursor.
+	Result interface{}
+}
+
+// Namespace returns "database.collection", the database alone when the
+// operation has no collection, or "" when it has neither.
+func (op *Operation) Namespace() string {
+	if op.Collection == "" {
+		return op.Database
+	}
+	return op.Database + "." + op.Collection
+}
+
+// isChangeStreamWait reports whether op is the Next or TryNext call of a
+// change stream, which lasts until a change happens rather than for as long
+// as the server takes to answer.
+func isChangeStreamWait(op *Operation) bool {
+	return strings.HasPrefix(op.ShortMethod(), "ChangeStream.")
+}
+
+// matchNamespace reports whether namespace matches pattern, which is either
+// a namespace or "db.*" for every collection of the database db.
+func matchNamespace(pattern, namespace string) bool {
+	if strings.HasSuffix(pattern, ".*") {
+		return strings.HasPrefix(namespace, strings.TrimSuffix(pattern, "*"))
+	}
+	return pattern == namespace
+}
+
+// ShortMethod returns Method without its "go.mongodb.org/mongo-driver."
+// prefix, such as "Collection.Find".
+func (op *Operation) ShortMethod() string {
+	return strings.TrimPrefix(op.Method, methodPrefix)
+}
+
+const methodPrefix = "go.mongodb.org/mongo-driver."
+
+// Invoker performs an operation, or hands it to the next interceptor.
+type Invoker func(ctx context.Context, op *Operation) error
+
+// Interceptor runs around an operation, much like a gRPC unary client
+// interceptor: it may inspect or change op, must call invoke to carry the
+// operation on, and may act on op.Result and the returned error afterwards.
+type Interceptor func(ctx context.Context, op *Operation, invoke Invoker) error
+
+// TracingInterceptor puts the operation in a span named after op.Method,
+// parented on the transaction of the wrapped session in ctx if any, and sets
+// the span status from the error. It is always installed first.
+func TracingInterceptor(ctx context.Context, op *Operation, invoke Invoker) error {
+	ctx, span := startSpan(ctx, op.Method)
+	defer span.End()
+
+	err := invoke(ctx, op)
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	return err
+}
+
+// MetricsInterceptor records the latency and outcome of the operation in
+// the mongo/client/latency and mongo/client/calls views. It is always
+// installed second. The latency of the Next and TryNext calls of change
+// streams includes the time spent waiting for a change and is only recorded
+// under their own method.
+func MetricsInterceptor(ctx context.Context, op *Operation, invoke Invoker) error {
+	start := time.Now()
+	err := invoke(ctx, op)
+	recordLatency(ctx, op.Method, start, err)
+	return err
+}
+
+var builtinInterceptors = []Interceptor{TracingInterceptor, MetricsInterceptor}
+
+// AddInterceptors appends interceptors to the chain every operation of the
+// client goes through, after the built-in tracing and metrics ones. It must
+// be called before the client is used. Calls taking a callback, such as
+// UseSession and WithTransaction, run the callback inside the chain. Only
+// the spans covering a transaction or an open GridFS stream, which outlive
+// any single call, are traced by the wrapper directly.
+func (wc *WrappedClient) AddInterceptors(interceptors ...Interceptor) {
+	wc.cfg.interceptors = append(wc.cfg.interceptors, interceptors...)
+}
+
+type uninstrumentedKey struct{}
+
+// uninstrumented returns a copy of ctx whose operations are neither traced
+// nor measured, for the wrapper's own calls. Those made for a caller, such
+// as explains, still go through the interceptors added to the client, so
+// that audit, guard and tenancy rules apply to them; the wrapper's own
+// statistics interceptors skip them. Bookkeeping writes made for no caller
+// also skip the interceptors, through withoutInterceptors.
+func uninstrumented(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uninstrumentedKey{}, true)
+}
+
+func isUninstrumented(ctx context.Context) bool {
+	skip, _ := ctx.Value(uninstrumentedKey{}).(bool)
+	return skip
+}
+
+// intercept runs op through the interceptor chain, ending with invoke.
+func (cfg *config) intercept(ctx context.Context, op *Operation, invoke Invoker) error {
+	var user []Interceptor
+	if cfg != nil {
+		user = cfg.interceptors
+	}
+	for i := len(user) - 1; i >= 0; i-- {
+		invoke = chain(user[i], invoke)
+	}
+	if !isUninstrumented(ctx) {
+		for i := len(builtinInterceptors) - 1; i >= 0; i-- {
+			invoke = chain(builtinInterceptors[i], invoke)
+		}
+	}
+	return invoke(ctx, op)
+}
+
+func chain(ic Interceptor, next Invoker) Invoker {
+	return func(ctx context.Context, op *Operation) error {
+		return ic(ctx, op, next)
+	}
+}
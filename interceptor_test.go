@@ -0,0 +1,204 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/trace"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestInterceptors(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	var calls []string
+	logging := func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		if trace.FromContext(ctx) == nil {
+			t.Errorf("%s: interceptor called outside of the operation span", op.ShortMethod())
+		}
+		calls = append(calls, op.ShortMethod()+" "+op.Namespace())
+		return invoke(ctx, op)
+	}
+	// onlyPublished restricts reads to published documents.
+	onlyPublished := func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		if op.ShortMethod() == "Collection.Find" {
+			op.Filter = bson.D{{Key: "$and", Value: bson.A{op.Filter, bson.M{"published": true}}}}
+		}
+		err := invoke(ctx, op)
+		if res, ok := op.Result.(*mongo.InsertOneResult); ok && err == nil && res.InsertedID == nil {
+			t.Errorf("InsertOne: Result has no inserted id")
+		}
+		return err
+	}
+
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("posts"), logging, onlyPublished)
+	ctx := context.Background()
+	for i, published := range []bool{true, false, true} {
+		if _, err := coll.InsertOne(ctx, bson.M{"_id": i, "published": published}); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+
+	cur, err := coll.FindWrapped(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var docs []bson.M
+	if err := cur.All(ctx, &docs); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Errorf("Find: got %d documents, want the 2 published ones", len(docs))
+	}
+
+	want := []string{
+		"Collection.InsertOne db.posts",
+		"Collection.InsertOne db.posts",
+		"Collection.InsertOne db.posts",
+		"Collection.Find db.posts",
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("interceptor calls: got %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("interceptor calls: got %v, want %v", calls, want)
+		}
+	}
+
+	// The built-in interceptors still trace and measure the calls.
+	rec.AssertSpan(t, "Collection.Find", nil, trace.StatusCodeOK)
+	rec.AssertCalls(t, "Collection.InsertOne", 3)
+}
+
+func TestInterceptorsSeeClientCalls(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	errDenied := errors.New("denied")
+	var calls []string
+	client.AddInterceptors(func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		calls = append(calls, op.ShortMethod())
+		if op.ShortMethod() == "Database.RunCommand" {
+			return errDenied
+		}
+		return invoke(ctx, op)
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	db := client.Database("db")
+
+	// A command failed by an interceptor carries the error only in the
+	// wrapped result.
+	if err := db.RunCommand(ctx, bson.D{{Key: "ping", Value: 1}}).Err(); err != mongo.ErrNoDocuments {
+		t.Errorf("RunCommand: got %v, want an empty result", err)
+	}
+	if _, err := db.RunCommandWrapped(ctx, bson.D{{Key: "ping", Value: 1}}).DecodeBytes(); err != errDenied {
+		t.Errorf("RunCommandWrapped: got %v, want the interceptor error", err)
+	}
+
+	err = client.UseSession(ctx, func(sc mongo.SessionContext) error {
+		_, err := db.Collection("c").InsertOne(sc, bson.M{"_id": 1})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("UseSession: %v", err)
+	}
+	_, err = client.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return db.Collection("c").InsertOne(sc, bson.M{"_id": 2})
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+
+	bucket, err := mongowrapper.NewBucket(db)
+	if err != nil {
+		t.Fatalf("NewBucket: %v", err)
+	}
+	id, err := bucket.UploadFromStream(ctx, "a.txt", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("UploadFromStream: %v", err)
+	}
+	var buf bytes.Buffer
+	if _, err := bucket.DownloadToStream(ctx, id, &buf); err != nil || buf.String() != "hello" {
+		t.Fatalf("DownloadToStream: got %q, %v", buf.String(), err)
+	}
+	if err := bucket.Rename(ctx, id, "b.txt"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err := bucket.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	want := []string{
+		"Client.Connect",
+		"Database.RunCommand",
+		"Database.RunCommand",
+		"Client.UseSession",
+		"Collection.InsertOne",
+		"Session.EndSession",
+		"Client.WithTransaction",
+		"Session.WithTransaction",
+		"Collection.InsertOne",
+		"Session.CommitTransaction",
+		"Session.EndSession",
+		"Bucket.UploadFromStream",
+		"Bucket.DownloadToStream",
+		"Bucket.Rename",
+		"Bucket.Delete",
+	}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("interceptor calls:\ngot  %v\nwant %v", calls, want)
+	}
+	rec.AssertSpan(t, "Session.CommitTransaction", nil, trace.StatusCodeOK)
+	rec.AssertSpan(t, "Bucket.UploadFromStream", map[string]interface{}{
+		"mongo.gridfs.bucket":   "db.fs",
+		"mongo.gridfs.filename": "a.txt",
+		"mongo.gridfs.bytes":    int64(5),
+	}, trace.StatusCodeOK)
+}
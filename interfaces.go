@@ -0,0 +1,134 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+// The interfaces below describe the operations of the wrapped types so that
+// code can depend on them and be handed fakes in tests. They leave out the
+// accessors of the underlying driver types and the methods that navigate
+// from one wrapped type to another, such as WrappedClient.Database: obtain
+// the Collection or Database once and pass it to the code that uses it.
+
+// Client is the set of operations of a WrappedClient.
+type Client interface {
+	Connect(ctx context.Context) error
+	Disconnect(ctx context.Context) error
+	ListDatabaseNames(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) ([]string, error)
+	ListDatabases(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) (mongo.ListDatabasesResult, error)
+	NumberSessionsInProgress() int
+	Ping(ctx context.Context, rp *readpref.ReadPref) error
+	StartSession(opts ...*options.SessionOptions) (mongo.Session, error)
+	UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error
+	UseSessionWithOptions(ctx context.Context, opts *options.SessionOptions, fn func(mongo.SessionContext) error) error
+	WatchWrapped(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error)
+	WithTransaction(ctx context.Context, fn func(mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error)
+}
+
+// Database is the set of operations of a WrappedDatabase.
+type Database interface {
+	AggregateWrapped(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error)
+	Drop(ctx context.Context) error
+	ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) ([]string, error)
+	ListCollectionsWrapped(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) (Cursor, error)
+	Name() string
+	ReadConcern() *readconcern.ReadConcern
+	ReadPreference() *readpref.ReadPref
+	RunCommandCursorWrapped(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) (Cursor, error)
+	RunCommandWrapped(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) SingleResult
+	WatchWrapped(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error)
+	WriteConcern() *writeconcern.WriteConcern
+}
+
+// Collection is the set of operations of a WrappedCollection.
+type Collection interface {
+	AggregateWrapped(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error)
+	BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error)
+	Count(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error)
+	Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error)
+	Drop(ctx context.Context) error
+	EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error)
+	FindWrapped(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error)
+	FindOneWrapped(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult
+	FindOneAndDeleteWrapped(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) SingleResult
+	FindOneAndReplaceWrapped(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) SingleResult
+	FindOneAndUpdateWrapped(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResult
+	InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error)
+	InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error)
+	Name() string
+	ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error)
+	UpdateMany(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	UpdateOne(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error)
+	WatchWrapped(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error)
+}
+
+// Session is the set of operations of a WrappedSession. Fakes can embed a
+// mongo.Session to satisfy its unexported method.
+type Session interface {
+	mongo.Session
+
+	StartTransactionContext(ctx context.Context, topts ...*options.TransactionOptions) (context.Context, error)
+	TransactionContext(ctx context.Context) context.Context
+	ID() string
+	TxnNumber() int64
+	ContextWithOperationTime(ctx context.Context) context.Context
+	AdvanceOperationTimeFromContext(ctx context.Context) error
+}
+
+// Cursor is the set of operations of a WrappedCursor. It is also
+// implemented by *mongo.Cursor; fakes can be turned into a WrappedCursor
+// with NewCursor.
+type Cursor interface {
+	ID() int64
+	Next(ctx context.Context) bool
+	TryNext(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+	All(ctx context.Context, results interface{}) error
+}
+
+// ChangeStream is the set of operations of a change stream. It is
+// implemented by *mongo.ChangeStream.
+type ChangeStream interface {
+	ID() int64
+	Next(ctx context.Context) bool
+	TryNext(ctx context.Context) bool
+	Decode(val interface{}) error
+	Err() error
+	Close(ctx context.Context) error
+	ResumeToken() bson.Raw
+}
+
+var (
+	_ Client       = (*WrappedClient)(nil)
+	_ Database     = (*WrappedDatabase)(nil)
+	_ Collection   = (*WrappedCollection)(nil)
+	_ Session      = (*WrappedSession)(nil)
+	_ Cursor       = (*mongo.Cursor)(nil)
+	_ ChangeStream = (*mongo.ChangeStream)(nil)
+)
@@ -21,20 +21,20 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// Connect creates a client and connects it, tracing both as a Connect call.
+// No interceptors can be added to the client before it connects; to have
+// them see the connection, use NewClient, AddInterceptors and
+// WrappedClient.Connect instead.
 func Connect(ctx context.Context, opts ...*options.ClientOptions) (*WrappedClient, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Connect")
-	defer span.end(ctx)
-
-	cc, err := mongo.NewClient(opts...)
-	if err != nil {
-		span.setError(err)
-		return nil, err
-	}
-
-	wc := &WrappedClient{cc: cc}
-	if err := wc.Connect(ctx); err != nil {
-		span.setError(err)
-	}
-
+	var wc *WrappedClient
+	err := new(config).intercept(ctx, &Operation{Method: methodPrefix + "Connect"}, func(ctx context.Context, op *Operation) error {
+		cc, err := mongo.NewClient(opts...)
+		if err != nil {
+			return err
+		}
+		wc = &WrappedClient{cc: cc, cfg: new(config)}
+		op.Result = wc
+		return wc.Connect(ctx)
+	})
 	return wc, err
 }
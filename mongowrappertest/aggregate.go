@@ -0,0 +1,371 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// aggregate runs pipeline over docs. The supported stages are $match,
+// $sort, $skip, $limit, $project, $unwind, $group and $count.
+func aggregate(docs []bson.D, pipeline []bson.D) ([]bson.D, error) {
+	for _, stage := range pipeline {
+		if len(stage) != 1 {
+			return nil, fmt.Errorf("mongowrappertest: a pipeline stage must have exactly one field")
+		}
+		var err error
+		switch st := stage[0]; st.Key {
+		case "$match":
+			docs, err = filterDocs(docs, st.Value)
+		case "$sort":
+			err = sortDocs(docs, st.Value)
+		case "$skip":
+			docs = skipDocs(docs, st.Value)
+		case "$limit":
+			docs = limitDocs(docs, st.Value)
+		case "$project":
+			docs, err = projectDocs(docs, st.Value)
+		case "$unwind":
+			docs, err = unwind(docs, st.Value)
+		case "$group":
+			docs, err = group(docs, st.Value)
+		case "$count":
+			name, ok := st.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("mongowrappertest: $count needs a field name")
+			}
+			docs = []bson.D{{{Key: name, Value: int32(len(docs))}}}
+		default:
+			err = fmt.Errorf("mongowrappertest: unsupported pipeline stage %s", st.Key)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return docs, nil
+}
+
+func filterDocs(docs []bson.D, filter interface{}) ([]bson.D, error) {
+	fd, ok := filter.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("mongowrappertest: a filter must be a document")
+	}
+	var out []bson.D
+	for _, d := range docs {
+		m, err := matches(d, fd)
+		if err != nil {
+			return nil, err
+		}
+		if m {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+
+func sortDocs(docs []bson.D, spec interface{}) error {
+	sd, ok := spec.(bson.D)
+	if !ok {
+		return fmt.Errorf("mongowrappertest: a sort specification must be a document")
+	}
+	sort.SliceStable(docs, func(i, j int) bool {
+		for _, key := range sd {
+			vi, _ := firstValue(docs[i], key.Key)
+			vj, _ := firstValue(docs[j], key.Key)
+			c, _ := compare(vi, vj)
+			if dir, _ := toFloat(key.Value); dir < 0 {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+func skipDocs(docs []bson.D, n interface{}) []bson.D {
+	skip, _ := toFloat(n)
+	if int(skip) >= len(docs) {
+		return nil
+	}
+	if skip > 0 {
+		docs = docs[int(skip):]
+	}
+	return docs
+}
+
+func limitDocs(docs []bson.D, n interface{}) []bson.D {
+	limit, _ := toFloat(n)
+	if limit < 0 {
+		limit = -limit
+	}
+	if limit > 0 && int(limit) < len(docs) {
+		docs = docs[:int(limit)]
+	}
+	return docs
+}
+
+func projectDocs(docs []bson.D, spec interface{}) ([]bson.D, error) {
+	pd, ok := spec.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("mongowrappertest: a projection must be a document")
+	}
+	out := make([]bson.D, 0, len(docs))
+	for _, d := range docs {
+		p, err := project(d, pd)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// project applies an inclusion or exclusion projection. Inclusions may also
+// compute a field from an expression such as "$other.field".
+func project(doc, spec bson.D) (bson.D, error) {
+	if len(spec) == 0 {
+		return doc, nil
+	}
+
+	includeID, exclusion := true, false
+	for _, e := range spec {
+		if e.Key == "_id" {
+			includeID = truthy(e.Value)
+			continue
+		}
+		if _, isNum := toFloat(e.Value); (isNum || isBool(e.Value)) && !truthy(e.Value) {
+			exclusion = true
+		}
+	}
+
+	if exclusion {
+		out := copyDoc(doc)
+		for _, e := range spec {
+			if e.Key == "_id" && includeID {
+				continue
+			}
+			if truthy(e.Value) {
+				return nil, fmt.Errorf("mongowrappertest: cannot mix inclusion and exclusion in a projection")
+			}
+			out = unsetPath(out, splitPath(e.Key))
+		}
+		return out, nil
+	}
+
+	out := bson.D{}
+	if id, ok := lookupKey(doc, "_id"); ok && includeID {
+		out = append(out, bson.E{Key: "_id", Value: id})
+	}
+	for _, e := range spec {
+		if e.Key == "_id" {
+			continue
+		}
+		var v interface{}
+		var ok bool
+		if _, isNum := toFloat(e.Value); isNum || isBool(e.Value) {
+			v, ok = firstValue(doc, e.Key)
+		} else {
+			v, ok = evalExpr(doc, e.Value), true
+		}
+		if !ok {
+			continue
+		}
+		var err error
+		if out, err = setPath(out, splitPath(e.Key), copyValue(v)); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func isBool(v interface{}) bool {
+	_, ok := v.(bool)
+	return ok
+}
+
+// evalExpr evaluates the small subset of aggregation expressions supported:
+// field paths such as "$a.b", documents of expressions and literals.
+func evalExpr(doc bson.D, expr interface{}) interface{} {
+	switch ev := expr.(type) {
+	case string:
+		if strings.HasPrefix(ev, "$") {
+			v, _ := firstValue(doc, ev[1:])
+			return v
+		}
+	case bson.D:
+		out := bson.D{}
+		for _, e := range ev {
+			out = append(out, bson.E{Key: e.Key, Value: evalExpr(doc, e.Value)})
+		}
+		return out
+	}
+	return expr
+}
+
+func unwind(docs []bson.D, spec interface{}) ([]bson.D, error) {
+	path, ok := spec.(string)
+	if sd, isDoc := spec.(bson.D); isDoc {
+		p, _ := lookupKey(sd, "path")
+		path, ok = p.(string)
+	}
+	if !ok || !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("mongowrappertest: $unwind needs a field path")
+	}
+	path = path[1:]
+
+	var out []bson.D
+	for _, d := range docs {
+		v, _ := firstValue(d, path)
+		arr, ok := v.(bson.A)
+		if !ok {
+			if v != nil {
+				out = append(out, d)
+			}
+			continue
+		}
+		for _, elem := range arr {
+			ud, err := setPath(copyDoc(d), splitPath(path), copyValue(elem))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, ud)
+		}
+	}
+	return out, nil
+}
+
+// group implements $group with the $sum, $avg, $min, $max, $first, $last,
+// $push and $addToSet accumulators.
+func group(docs []bson.D, spec interface{}) ([]bson.D, error) {
+	gd, ok := spec.(bson.D)
+	if !ok {
+		return nil, fmt.Errorf("mongowrappertest: $group needs a document")
+	}
+	idExpr, ok := lookupKey(gd, "_id")
+	if !ok {
+		return nil, fmt.Errorf("mongowrappertest: $group needs an _id")
+	}
+
+	type bucket struct {
+		id      interface{}
+		members []bson.D
+	}
+	var buckets []*bucket
+	for _, d := range docs {
+		id := evalExpr(d, idExpr)
+		var b *bucket
+		for _, cand := range buckets {
+			if equal(cand.id, id) {
+				b = cand
+				break
+			}
+		}
+		if b == nil {
+			b = &bucket{id: id}
+			buckets = append(buckets, b)
+		}
+		b.members = append(b.members, d)
+	}
+
+	out := make([]bson.D, 0, len(buckets))
+	for _, b := range buckets {
+		res := bson.D{{Key: "_id", Value: b.id}}
+		for _, field := range gd {
+			if field.Key == "_id" {
+				continue
+			}
+			acc, ok := field.Value.(bson.D)
+			if !ok || len(acc) != 1 {
+				return nil, fmt.Errorf("mongowrappertest: %s must be an accumulator", field.Key)
+			}
+			v, err := accumulate(acc[0].Key, acc[0].Value, b.members)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, bson.E{Key: field.Key, Value: v})
+		}
+		out = append(out, res)
+	}
+	return out, nil
+}
+
+func accumulate(op string, expr interface{}, docs []bson.D) (interface{}, error) {
+	values := make([]interface{}, 0, len(docs))
+	for _, d := range docs {
+		values = append(values, evalExpr(d, expr))
+	}
+
+	switch op {
+	case "$sum", "$avg":
+		var sum interface{} = int32(0)
+		n := 0
+		for _, v := range values {
+			if _, ok := toFloat(v); !ok {
+				continue
+			}
+			sum, _ = add(sum, v)
+			n++
+		}
+		if op == "$sum" {
+			return sum, nil
+		}
+		if n == 0 {
+			return nil, nil
+		}
+		f, _ := toFloat(sum)
+		return f / float64(n), nil
+	case "$min", "$max":
+		var best interface{}
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			c, _ := compare(v, best)
+			if best == nil || (op == "$min" && c < 0) || (op == "$max" && c > 0) {
+				best = v
+			}
+		}
+		return best, nil
+	case "$first":
+		return values[0], nil
+	case "$last":
+		return values[len(values)-1], nil
+	case "$push":
+		return bson.A(values), nil
+	case "$addToSet":
+		set := bson.A{}
+		for _, v := range values {
+			seen := false
+			for _, s := range set {
+				if equal(s, v) {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				set = append(set, v)
+			}
+		}
+		return set, nil
+	}
+	return nil, fmt.Errorf("mongowrappertest: unsupported accumulator %s", op)
+}
@@ -0,0 +1,724 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const defaultBatchSize = 101
+
+// serverCursor holds the documents of a find or aggregate that did not fit
+// in the first batch. Change stream cursors stay open once drained.
+type serverCursor struct {
+	ns     string
+	docs   []bson.D
+	stream bool
+}
+
+// runCommand executes cmd against database db and returns the reply
+// document. Failures are reported in the reply, as a server would.
+func (s *Server) runCommand(db string, cmd bson.D) bson.D {
+	if len(cmd) == 0 {
+		return commandError(9, "FailedToParse", "empty command")
+	}
+
+	name := cmd[0].Key
+	switch name {
+	case "isMaster", "ismaster", "hello":
+		return s.isMaster(name == "hello")
+	case "ping", "endSessions", "commitTransaction", "abortTransaction":
+		return bson.D{{Key: "ok", Value: 1.0}}
+	case "buildInfo", "buildinfo":
+		return bson.D{
+			{Key: "version", Value: "4.2.0"},
+			{Key: "versionArray", Value: bson.A{int32(4), int32(2), int32(0), int32(0)}},
+			{Key: "ok", Value: 1.0},
+		}
+	case "getMore":
+		return s.getMore(cmd)
+	case "killCursors":
+		return s.killCursors(cmd)
+	case "explain":
+		return s.explain(db, cmd)
+	case "listCollections":
+		return s.listCollections(db, cmd)
+	case "aggregate":
+		pipeline, _ := lookupKey(cmd, "pipeline")
+		if stages, err := toDocs(pipeline); err == nil && len(stages) > 0 && stages[0][0].Key == "$changeStream" {
+			return s.changeStream(db, cmd, stages)
+		}
+	}
+
+	collName, ok := cmd[0].Value.(string)
+	if !ok {
+		return commandError(59, "CommandNotFound", fmt.Sprintf("no such command: '%s'", name))
+	}
+	ns := db + "." + collName
+	coll := s.Collection(db, collName)
+
+	switch name {
+	case "find":
+		return s.find(ns, coll, cmd)
+	case "aggregate":
+		return s.aggregate(ns, coll, cmd)
+	case "insert":
+		return insert(coll, cmd)
+	case "update":
+		return update(coll, cmd)
+	case "delete":
+		return remove(coll, cmd)
+	case "findAndModify", "findandmodify":
+		return findAndModify(coll, cmd)
+	case "count":
+		return count(coll, cmd)
+	case "distinct":
+		return distinct(coll, cmd)
+	case "drop":
+		coll.Drop(context.Background())
+		s.mu.Lock()
+		delete(s.indexes, ns)
+		s.mu.Unlock()
+		return bson.D{{Key: "ns", Value: ns}, {Key: "ok", Value: 1.0}}
+	case "listIndexes":
+		return s.listIndexes(ns, cmd)
+	case "createIndexes":
+		return s.createIndexes(ns, cmd)
+	case "dropIndexes":
+		return s.dropIndexes(ns, cmd)
+	}
+	return commandError(59, "CommandNotFound", fmt.Sprintf("no such command: '%s'", name))
+}
+
+func (s *Server) isMaster(hello bool) bson.D {
+	reply := bson.D{{Key: "ismaster", Value: true}}
+	if hello {
+		reply = bson.D{{Key: "isWritablePrimary", Value: true}}
+	}
+	return append(reply,
+		bson.E{Key: "maxBsonObjectSize", Value: int32(16 * 1024 * 1024)},
+		bson.E{Key: "maxMessageSizeBytes", Value: int32(maxMessageSize)},
+		bson.E{Key: "maxWriteBatchSize", Value: int32(100000)},
+		bson.E{Key: "localTime", Value: time.Now()},
+		bson.E{Key: "logicalSessionTimeoutMinutes", Value: int32(30)},
+		bson.E{Key: "minWireVersion", Value: int32(0)},
+		bson.E{Key: "maxWireVersion", Value: int32(8)},
+		bson.E{Key: "readOnly", Value: false},
+		bson.E{Key: "ok", Value: 1.0},
+	)
+}
+
+func (s *Server) find(ns string, coll *Collection, cmd bson.D) bson.D {
+	filter, _ := lookupKey(cmd, "filter")
+	sort, _ := lookupKey(cmd, "sort")
+	projection, _ := lookupKey(cmd, "projection")
+
+	var skip, limit *int64
+	if n, ok := intField(cmd, "skip"); ok {
+		skip = &n
+	}
+	single := boolField(cmd, "singleBatch")
+	if n, ok := intField(cmd, "limit"); ok && n != 0 {
+		if n < 0 {
+			n, single = -n, true
+		}
+		limit = &n
+	}
+
+	docs, err := coll.query(filter, sort, skip, limit)
+	if err == nil {
+		docs, err = projectAll(docs, projection)
+	}
+	if err != nil {
+		return commandError(2, "BadValue", err.Error())
+	}
+	batchSize, _ := intField(cmd, "batchSize")
+	return s.cursorReply(ns, docs, batchSize, single)
+}
+
+func (s *Server) aggregate(ns string, coll *Collection, cmd bson.D) bson.D {
+	pipeline, _ := lookupKey(cmd, "pipeline")
+	stages, err := toDocs(pipeline)
+	if err != nil {
+		return commandError(9, "FailedToParse", err.Error())
+	}
+	docs, err := aggregate(coll.snapshot(), stages)
+	if err != nil {
+		return commandError(2, "BadValue", err.Error())
+	}
+	var batchSize int64
+	if opts, ok := lookupKey(cmd, "cursor"); ok {
+		if od, ok := opts.(bson.D); ok {
+			batchSize, _ = intField(od, "batchSize")
+		}
+	}
+	return s.cursorReply(ns, docs, batchSize, false)
+}
+
+// cursorReply returns the first batch of docs, keeping the rest in a server
+// cursor for getMore.
+func (s *Server) cursorReply(ns string, docs []bson.D, batchSize int64, single bool) bson.D {
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	n := len(docs)
+	if !single && int64(n) > batchSize {
+		n = int(batchSize)
+	}
+
+	var id int64
+	if n < len(docs) {
+		s.mu.Lock()
+		s.lastCursorID++
+		id = s.lastCursorID
+		s.cursors[id] = &serverCursor{ns: ns, docs: docs[n:]}
+		s.mu.Unlock()
+	}
+	return bson.D{
+		{Key: "cursor", Value: bson.D{
+			{Key: "firstBatch", Value: docsArray(docs[:n])},
+			{Key: "id", Value: id},
+			{Key: "ns", Value: ns},
+		}},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+// changeStream opens a change stream on a collection, the collections of db
+// or the whole server. The stream reports the documents present when it is
+// opened as inserts, and no later changes.
+func (s *Server) changeStream(db string, cmd bson.D, stages []bson.D) bson.D {
+	collName, _ := cmd[0].Value.(string)
+	csOpts, _ := stages[0][0].Value.(bson.D)
+	v, _ := lookupKey(csOpts, "allChangesForCluster")
+	cluster, _ := v.(bool)
+
+	s.mu.Lock()
+	var nss []string
+	colls := make(map[string]*Collection)
+	for ns, c := range s.collections {
+		if cluster || ns == db+"."+collName || collName == "" && strings.HasPrefix(ns, db+".") {
+			nss = append(nss, ns)
+			colls[ns] = c
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(nss)
+
+	var events []bson.D
+	for _, ns := range nss {
+		i := strings.Index(ns, ".")
+		for _, doc := range colls[ns].snapshot() {
+			id, _ := lookupKey(doc, "_id")
+			events = append(events, bson.D{
+				{Key: "_id", Value: bson.D{{Key: "_data", Value: fmt.Sprintf("%016X", len(events)+1)}}},
+				{Key: "operationType", Value: "insert"},
+				{Key: "fullDocument", Value: doc},
+				{Key: "ns", Value: bson.D{{Key: "db", Value: ns[:i]}, {Key: "coll", Value: ns[i+1:]}}},
+				{Key: "documentKey", Value: bson.D{{Key: "_id", Value: id}}},
+			})
+		}
+	}
+	events, err := aggregate(events, stages[1:])
+	if err != nil {
+		return commandError(2, "BadValue", err.Error())
+	}
+
+	ns := db + "." + collName
+	if collName == "" {
+		ns = db + ".$cmd.aggregate"
+	}
+	var batchSize int64 = defaultBatchSize
+	if opts, ok := lookupKey(cmd, "cursor"); ok {
+		if od, ok := opts.(bson.D); ok {
+			if n, ok := intField(od, "batchSize"); ok {
+				batchSize = n
+			}
+		}
+	}
+	n := len(events)
+	if int64(n) > batchSize {
+		n = int(batchSize)
+	}
+
+	s.mu.Lock()
+	s.lastCursorID++
+	id := s.lastCursorID
+	s.cursors[id] = &serverCursor{ns: ns, docs: events[n:], stream: true}
+	s.mu.Unlock()
+	return bson.D{
+		{Key: "cursor", Value: bson.D{
+			{Key: "firstBatch", Value: docsArray(events[:n])},
+			{Key: "id", Value: id},
+			{Key: "ns", Value: ns},
+		}},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+func (s *Server) getMore(cmd bson.D) bson.D {
+	id, _ := intField(cmd, "getMore")
+	batchSize, _ := intField(cmd, "batchSize")
+	if batchSize <= 0 {
+		batchSize = int64(^uint32(0) >> 1)
+	}
+
+	s.mu.Lock()
+	sc, ok := s.cursors[id]
+	if !ok {
+		s.mu.Unlock()
+		return commandError(43, "CursorNotFound", fmt.Sprintf("cursor id %d not found", id))
+	}
+	n := len(sc.docs)
+	if int64(n) > batchSize {
+		n = int(batchSize)
+	}
+	batch := sc.docs[:n]
+	sc.docs = sc.docs[n:]
+	if len(sc.docs) == 0 && !sc.stream {
+		delete(s.cursors, id)
+		id = 0
+	}
+	s.mu.Unlock()
+
+	return bson.D{
+		{Key: "cursor", Value: bson.D{
+			{Key: "nextBatch", Value: docsArray(batch)},
+			{Key: "id", Value: id},
+			{Key: "ns", Value: sc.ns},
+		}},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+// listCollections lists the collections of db the Server has seen, matching
+// the filter of cmd.
+func (s *Server) listCollections(db string, cmd bson.D) bson.D {
+	v, _ := lookupKey(cmd, "filter")
+	filter, _ := v.(bson.D)
+
+	s.mu.Lock()
+	var names []string
+	for ns := range s.collections {
+		if strings.HasPrefix(ns, db+".") {
+			names = append(names, ns[len(db)+1:])
+		}
+	}
+	s.mu.Unlock()
+	sort.Strings(names)
+
+	var docs []bson.D
+	for _, name := range names {
+		doc := bson.D{
+			{Key: "name", Value: name},
+			{Key: "type", Value: "collection"},
+			{Key: "options", Value: bson.D{}},
+			{Key: "info", Value: bson.D{{Key: "readOnly", Value: false}}},
+		}
+		ok, err := matches(doc, filter)
+		if err != nil {
+			return commandError(2, "BadValue", err.Error())
+		}
+		if ok {
+			docs = append(docs, doc)
+		}
+	}
+	return s.cursorReply(db+".$cmd.listCollections", docs, 0, false)
+}
+
+// listIndexes lists the indexes created on ns, after the _id one every
+// collection has. Indexes are only recorded, never used by queries.
+func (s *Server) listIndexes(ns string, cmd bson.D) bson.D {
+	specs := []bson.D{{
+		{Key: "v", Value: int32(2)},
+		{Key: "key", Value: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Key: "name", Value: "_id_"},
+		{Key: "ns", Value: ns},
+	}}
+	s.mu.Lock()
+	specs = append(specs, s.indexes[ns]...)
+	s.mu.Unlock()
+
+	var batchSize int64
+	if opts, ok := lookupKey(cmd, "cursor"); ok {
+		if od, ok := opts.(bson.D); ok {
+			batchSize, _ = intField(od, "batchSize")
+		}
+	}
+	return s.cursorReply(ns, specs, batchSize, false)
+}
+
+func (s *Server) createIndexes(ns string, cmd bson.D) bson.D {
+	v, _ := lookupKey(cmd, "indexes")
+	models, err := toDocs(v)
+	if err != nil {
+		return commandError(9, "FailedToParse", err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.indexes[ns]) + 1
+	for _, model := range models {
+		name, _ := lookupKey(model, "name")
+		if name == "_id_" || indexNamed(s.indexes[ns], name) >= 0 {
+			continue
+		}
+		spec := bson.D{{Key: "v", Value: int32(2)}}
+		for _, e := range model {
+			if e.Key != "v" && e.Key != "ns" {
+				spec = append(spec, e)
+			}
+		}
+		s.indexes[ns] = append(s.indexes[ns], append(spec, bson.E{Key: "ns", Value: ns}))
+	}
+	return bson.D{
+		{Key: "createdCollectionAutomatically", Value: false},
+		{Key: "numIndexesBefore", Value: int32(before)},
+		{Key: "numIndexesAfter", Value: int32(len(s.indexes[ns]) + 1)},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+func (s *Server) dropIndexes(ns string, cmd bson.D) bson.D {
+	name, _ := lookupKey(cmd, "index")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	was := len(s.indexes[ns]) + 1
+	if name == "*" {
+		delete(s.indexes, ns)
+	} else if i := indexNamed(s.indexes[ns], name); i >= 0 {
+		s.indexes[ns] = append(s.indexes[ns][:i:i], s.indexes[ns][i+1:]...)
+	} else {
+		return commandError(27, "IndexNotFound", fmt.Sprintf("index not found with name [%v]", name))
+	}
+	return bson.D{{Key: "nIndexesWas", Value: int32(was)}, {Key: "ok", Value: 1.0}}
+}
+
+func indexNamed(specs []bson.D, name interface{}) int {
+	for i, spec := range specs {
+		if n, _ := lookupKey(spec, "name"); n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Server) killCursors(cmd bson.D) bson.D {
+	ids, _ := lookupKey(cmd, "cursors")
+	arr, _ := ids.(bson.A)
+
+	killed, notFound := bson.A{}, bson.A{}
+	s.mu.Lock()
+	for _, v := range arr {
+		f, _ := toFloat(v)
+		id := int64(f)
+		if _, ok := s.cursors[id]; ok {
+			delete(s.cursors, id)
+			killed = append(killed, id)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+	s.mu.Unlock()
+
+	return bson.D{
+		{Key: "cursorsKilled", Value: killed},
+		{Key: "cursorsNotFound", Value: notFound},
+		{Key: "cursorsAlive", Value: bson.A{}},
+		{Key: "cursorsUnknown", Value: bson.A{}},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+func insert(coll *Collection, cmd bson.D) bson.D {
+	docs, _ := lookupKey(cmd, "documents")
+	arr, _ := docs.(bson.A)
+	ordered := orderedField(cmd)
+
+	var n int32
+	var writeErrors bson.A
+	for i, doc := range arr {
+		if _, err := coll.InsertOne(context.Background(), doc); err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			if ordered {
+				break
+			}
+			continue
+		}
+		n++
+	}
+	return writeReply(bson.D{{Key: "n", Value: n}}, writeErrors)
+}
+
+func update(coll *Collection, cmd bson.D) bson.D {
+	updates, _ := lookupKey(cmd, "updates")
+	arr, _ := updates.(bson.A)
+	ordered := orderedField(cmd)
+
+	var n, modified int32
+	var upserted, writeErrors bson.A
+	for i, v := range arr {
+		spec, _ := v.(bson.D)
+		q, _ := lookupKey(spec, "q")
+		u, _ := lookupKey(spec, "u")
+		ud, isDoc := u.(bson.D)
+		if !isDoc {
+			writeErrors = append(writeErrors, writeError(i, fmt.Errorf("mongowrappertest: update must be a document, got %T", u)))
+			if ordered {
+				break
+			}
+			continue
+		}
+
+		res, err := coll.update(q, ud, boolField(spec, "multi"), !isUpdateDoc(ud), boolField(spec, "upsert"))
+		if err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			if ordered {
+				break
+			}
+			continue
+		}
+		n += int32(res.MatchedCount + res.UpsertedCount)
+		modified += int32(res.ModifiedCount)
+		if res.UpsertedID != nil {
+			upserted = append(upserted, bson.D{{Key: "index", Value: int32(i)}, {Key: "_id", Value: res.UpsertedID}})
+		}
+	}
+
+	reply := bson.D{{Key: "n", Value: n}, {Key: "nModified", Value: modified}}
+	if len(upserted) > 0 {
+		reply = append(reply, bson.E{Key: "upserted", Value: upserted})
+	}
+	return writeReply(reply, writeErrors)
+}
+
+func remove(coll *Collection, cmd bson.D) bson.D {
+	deletes, _ := lookupKey(cmd, "deletes")
+	arr, _ := deletes.(bson.A)
+	ordered := orderedField(cmd)
+
+	var n int32
+	var writeErrors bson.A
+	for i, v := range arr {
+		spec, _ := v.(bson.D)
+		q, _ := lookupKey(spec, "q")
+		limit, _ := intField(spec, "limit")
+		deleted, err := coll.delete(q, limit == 0)
+		if err != nil {
+			writeErrors = append(writeErrors, writeError(i, err))
+			if ordered {
+				break
+			}
+			continue
+		}
+		n += int32(deleted)
+	}
+	return writeReply(bson.D{{Key: "n", Value: n}}, writeErrors)
+}
+
+func findAndModify(coll *Collection, cmd bson.D) bson.D {
+	query, _ := lookupKey(cmd, "query")
+	sort, _ := lookupKey(cmd, "sort")
+	fields, _ := lookupKey(cmd, "fields")
+	upsert := boolField(cmd, "upsert")
+
+	remove := boolField(cmd, "remove")
+	var doc bson.D
+	var existed bool
+	var err error
+	if remove {
+		doc, err = coll.deleteOne(query, sort)
+		existed = doc != nil
+	} else {
+		u, _ := lookupKey(cmd, "update")
+		ud, _ := u.(bson.D)
+		doc, existed, err = coll.modifyOne(query, ud, !isUpdateDoc(ud), sort, boolField(cmd, "new"), upsert)
+	}
+	if err != nil {
+		if we, ok := err.(mongo.WriteException); ok && len(we.WriteErrors) > 0 {
+			return commandError(int32(we.WriteErrors[0].Code), "", we.WriteErrors[0].Message)
+		}
+		return commandError(2, "BadValue", err.Error())
+	}
+
+	var value interface{}
+	if doc != nil {
+		docs, err := projectAll([]bson.D{doc}, fields)
+		if err != nil {
+			return commandError(2, "BadValue", err.Error())
+		}
+		value = docs[0]
+	}
+
+	var n int32
+	if existed || upsert {
+		n = 1
+	}
+	return bson.D{
+		{Key: "lastErrorObject", Value: bson.D{
+			{Key: "n", Value: n},
+			{Key: "updatedExisting", Value: existed && !remove},
+		}},
+		{Key: "value", Value: value},
+		{Key: "ok", Value: 1.0},
+	}
+}
+
+// explain describes the find, aggregate or count wrapped in cmd. Having no
+// indexes, the server always plans a collection scan.
+func (s *Server) explain(db string, cmd bson.D) bson.D {
+	inner, ok := cmd[0].Value.(bson.D)
+	if !ok || len(inner) == 0 {
+		return commandError(9, "FailedToParse", "explain must be a document")
+	}
+	collName, _ := inner[0].Value.(string)
+	ns := db + "." + collName
+	coll := s.Collection(db, collName)
+
+	var docs []bson.D
+	var err error
+	switch inner[0].Key {
+	case "find", "count":
+		key := "filter"
+		if inner[0].Key == "count" {
+			key = "query"
+		}
+		filter, _ := lookupKey(inner, key)
+		docs, err = coll.query(filter, nil, nil, nil)
+	case "aggregate":
+		pipeline, _ := lookupKey(inner, "pipeline")
+		var stages []bson.D
+		if stages, err = toDocs(pipeline); err == nil {
+			docs, err = aggregate(coll.snapshot(), stages)
+		}
+	default:
+		return commandError(59, "CommandNotFound", fmt.Sprintf("explain of '%s' is not supported", inner[0].Key))
+	}
+	if err != nil {
+		return commandError(2, "BadValue", err.Error())
+	}
+
+	scan := bson.D{{Key: "stage", Value: "COLLSCAN"}, {Key: "direction", Value: "forward"}}
+	plan := bson.D{
+		{Key: "queryPlanner", Value: bson.D{
+			{Key: "namespace", Value: ns},
+			{Key: "winningPlan", Value: scan},
+			{Key: "rejectedPlans", Value: bson.A{}},
+		}},
+		{Key: "executionStats", Value: bson.D{
+			{Key: "nReturned", Value: int32(len(docs))},
+			{Key: "totalKeysExamined", Value: int32(0)},
+			{Key: "totalDocsExamined", Value: int32(len(coll.snapshot()))},
+			{Key: "executionStages", Value: scan},
+		}},
+	}
+	if inner[0].Key == "aggregate" {
+		// Aggregations report the plan of their leading $cursor stage.
+		return bson.D{
+			{Key: "stages", Value: bson.A{bson.D{{Key: "$cursor", Value: plan}}}},
+			{Key: "ok", Value: 1.0},
+		}
+	}
+	return append(plan, bson.E{Key: "ok", Value: 1.0})
+}
+
+func count(coll *Collection, cmd bson.D) bson.D {
+	query, _ := lookupKey(cmd, "query")
+	var skip, limit *int64
+	if n, ok := intField(cmd, "skip"); ok {
+		skip = &n
+	}
+	if n, ok := intField(cmd, "limit"); ok && n != 0 {
+		if n < 0 {
+			n = -n
+		}
+		limit = &n
+	}
+	docs, err := coll.query(query, nil, skip, limit)
+	if err != nil {
+		return commandError(2, "BadValue", err.Error())
+	}
+	return bson.D{{Key: "n", Value: int32(len(docs))}, {Key: "ok", Value: 1.0}}
+}
+
+func distinct(coll *Collection, cmd bson.D) bson.D {
+	key, _ := lookupKey(cmd, "key")
+	field, _ := key.(string)
+	query, _ := lookupKey(cmd, "query")
+	values, err := coll.Distinct(context.Background(), field, query)
+	if err != nil {
+		return commandError(2, "BadValue", err.Error())
+	}
+	return bson.D{{Key: "values", Value: bson.A(values)}, {Key: "ok", Value: 1.0}}
+}
+
+func commandError(code int32, codeName, msg string) bson.D {
+	return bson.D{
+		{Key: "ok", Value: 0.0},
+		{Key: "errmsg", Value: msg},
+		{Key: "code", Value: code},
+		{Key: "codeName", Value: codeName},
+	}
+}
+
+func writeError(index int, err error) bson.D {
+	code, msg := int32(2), err.Error()
+	if we, ok := err.(mongo.WriteException); ok && len(we.WriteErrors) > 0 {
+		code, msg = int32(we.WriteErrors[0].Code), we.WriteErrors[0].Message
+	}
+	return bson.D{{Key: "index", Value: int32(index)}, {Key: "code", Value: code}, {Key: "errmsg", Value: msg}}
+}
+
+func writeReply(reply bson.D, writeErrors bson.A) bson.D {
+	if len(writeErrors) > 0 {
+		reply = append(reply, bson.E{Key: "writeErrors", Value: writeErrors})
+	}
+	return append(reply, bson.E{Key: "ok", Value: 1.0})
+}
+
+func docsArray(docs []bson.D) bson.A {
+	arr := make(bson.A, len(docs))
+	for i, d := range docs {
+		arr[i] = d
+	}
+	return arr
+}
+
+func intField(d bson.D, key string) (int64, bool) {
+	v, ok := lookupKey(d, key)
+	if !ok {
+		return 0, false
+	}
+	f, ok := toFloat(v)
+	return int64(f), ok
+}
+
+func boolField(d bson.D, key string) bool {
+	v, _ := lookupKey(d, key)
+	return truthy(v)
+}
+
+func orderedField(d bson.D) bool {
+	v, ok := lookupKey(d, "ordered")
+	return !ok || truthy(v)
+}
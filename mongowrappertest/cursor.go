@@ -0,0 +1,113 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// cursor iterates over documents held in memory.
+type cursor struct {
+	docs    []bson.Raw
+	current bson.Raw
+	closed  bool
+}
+
+func newCursor(docs []bson.D) (*cursor, error) {
+	raws := make([]bson.Raw, 0, len(docs))
+	for _, d := range docs {
+		raw, err := bson.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		raws = append(raws, raw)
+	}
+	return &cursor{docs: raws}, nil
+}
+
+func (c *cursor) ID() int64  { return 0 }
+func (c *cursor) Err() error { return nil }
+
+func (c *cursor) Next(ctx context.Context) bool {
+	if c.closed || len(c.docs) == 0 {
+		return false
+	}
+	c.current, c.docs = c.docs[0], c.docs[1:]
+	return true
+}
+
+func (c *cursor) TryNext(ctx context.Context) bool { return c.Next(ctx) }
+
+func (c *cursor) Decode(val interface{}) error {
+	if c.current == nil {
+		return errors.New("mongowrappertest: Decode called before Next")
+	}
+	return bson.Unmarshal(c.current, val)
+}
+
+func (c *cursor) Close(ctx context.Context) error {
+	c.closed = true
+	c.docs = nil
+	return nil
+}
+
+func (c *cursor) All(ctx context.Context, results interface{}) error {
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return errors.New("results argument must be a pointer to a slice")
+	}
+	sv := rv.Elem()
+	sv.Set(sv.Slice(0, 0))
+	for c.Next(ctx) {
+		elem := reflect.New(sv.Type().Elem())
+		if err := c.Decode(elem.Interface()); err != nil {
+			return err
+		}
+		sv.Set(reflect.Append(sv, elem.Elem()))
+	}
+	return c.Close(ctx)
+}
+
+// singleResult holds the outcome of FindOne and the FindOneAnd* methods.
+type singleResult struct {
+	doc bson.Raw
+	err error
+}
+
+func newSingleResult(doc bson.D, found bool, err error) *singleResult {
+	if err != nil {
+		return &singleResult{err: err}
+	}
+	if !found {
+		return &singleResult{err: mongo.ErrNoDocuments}
+	}
+	raw, err := bson.Marshal(doc)
+	return &singleResult{doc: raw, err: err}
+}
+
+func (sr *singleResult) Decode(v interface{}) error {
+	if sr.err != nil {
+		return sr.err
+	}
+	return bson.Unmarshal(sr.doc, v)
+}
+
+func (sr *singleResult) DecodeBytes() (bson.Raw, error) { return sr.doc, sr.err }
+func (sr *singleResult) Err() error                     { return sr.err }
@@ -0,0 +1,263 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// matches reports whether doc satisfies filter. The supported operators are
+// $and, $or, $nor, $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $not,
+// $regex, $size, $all and $elemMatch.
+func matches(doc, filter bson.D) (bool, error) {
+	for _, e := range filter {
+		ok, err := matchElem(doc, e)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchElem(doc bson.D, e bson.E) (bool, error) {
+	switch e.Key {
+	case "$and", "$or", "$nor":
+		clauses, ok := e.Value.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("mongowrappertest: %s needs an array", e.Key)
+		}
+		for _, c := range clauses {
+			cd, ok := c.(bson.D)
+			if !ok {
+				return false, fmt.Errorf("mongowrappertest: %s entries must be documents", e.Key)
+			}
+			m, err := matches(doc, cd)
+			if err != nil {
+				return false, err
+			}
+			switch {
+			case e.Key == "$and" && !m:
+				return false, nil
+			case e.Key == "$or" && m:
+				return true, nil
+			case e.Key == "$nor" && m:
+				return false, nil
+			}
+		}
+		return e.Key != "$or", nil
+	}
+	if strings.HasPrefix(e.Key, "$") {
+		return false, fmt.Errorf("mongowrappertest: unsupported query operator %s", e.Key)
+	}
+
+	values := lookupPath(doc, splitPath(e.Key))
+	if cond, ok := e.Value.(bson.D); ok && isOperatorDoc(cond) {
+		return matchOperators(values, cond)
+	}
+	return matchEq(values, e.Value), nil
+}
+
+func isOperatorDoc(d bson.D) bool {
+	return len(d) > 0 && strings.HasPrefix(d[0].Key, "$")
+}
+
+// expand adds the elements of array values to values, since a condition on
+// a field holding an array matches if it holds for any element.
+func expand(values []interface{}) []interface{} {
+	out := append([]interface{}(nil), values...)
+	for _, v := range values {
+		if arr, ok := v.(bson.A); ok {
+			out = append(out, arr...)
+		}
+	}
+	return out
+}
+
+func matchEq(values []interface{}, want interface{}) bool {
+	if len(values) == 0 {
+		return want == nil
+	}
+	if re, ok := want.(primitive.Regex); ok {
+		return matchRegex(values, re.Pattern, re.Options)
+	}
+	for _, v := range expand(values) {
+		if equal(v, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchOperators(values []interface{}, cond bson.D) (bool, error) {
+	for _, op := range cond {
+		ok, err := matchOperator(values, op, cond)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(values []interface{}, op bson.E, cond bson.D) (bool, error) {
+	switch op.Key {
+	case "$eq":
+		return matchEq(values, op.Value), nil
+	case "$ne":
+		return !matchEq(values, op.Value), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		for _, v := range expand(values) {
+			c, ok := compare(v, op.Value)
+			if !ok {
+				continue
+			}
+			if (op.Key == "$gt" && c > 0) || (op.Key == "$gte" && c >= 0) ||
+				(op.Key == "$lt" && c < 0) || (op.Key == "$lte" && c <= 0) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$in", "$nin":
+		arr, ok := op.Value.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("mongowrappertest: %s needs an array", op.Key)
+		}
+		in := false
+		for _, want := range arr {
+			if matchEq(values, want) {
+				in = true
+				break
+			}
+		}
+		return in == (op.Key == "$in"), nil
+	case "$exists":
+		return (len(values) > 0) == truthy(op.Value), nil
+	case "$not":
+		sub, ok := op.Value.(bson.D)
+		if !ok {
+			if re, ok := op.Value.(primitive.Regex); ok {
+				return !matchRegex(values, re.Pattern, re.Options), nil
+			}
+			return false, fmt.Errorf("mongowrappertest: $not needs a document or a regex")
+		}
+		m, err := matchOperators(values, sub)
+		return !m, err
+	case "$regex":
+		pattern, opts := "", ""
+		switch re := op.Value.(type) {
+		case string:
+			pattern = re
+		case primitive.Regex:
+			pattern, opts = re.Pattern, re.Options
+		default:
+			return false, fmt.Errorf("mongowrappertest: $regex needs a string or a regex")
+		}
+		if o, ok := lookupKey(cond, "$options"); ok {
+			opts, _ = o.(string)
+		}
+		return matchRegex(values, pattern, opts), nil
+	case "$options":
+		return true, nil
+	case "$size":
+		n, ok := toFloat(op.Value)
+		if !ok {
+			return false, fmt.Errorf("mongowrappertest: $size needs a number")
+		}
+		for _, v := range values {
+			if arr, ok := v.(bson.A); ok && float64(len(arr)) == n {
+				return true, nil
+			}
+		}
+		return false, nil
+	case "$all":
+		arr, ok := op.Value.(bson.A)
+		if !ok {
+			return false, fmt.Errorf("mongowrappertest: $all needs an array")
+		}
+		for _, want := range arr {
+			if !matchEq(values, want) {
+				return false, nil
+			}
+		}
+		return len(arr) > 0, nil
+	case "$elemMatch":
+		sub, ok := op.Value.(bson.D)
+		if !ok {
+			return false, fmt.Errorf("mongowrappertest: $elemMatch needs a document")
+		}
+		for _, v := range values {
+			arr, ok := v.(bson.A)
+			if !ok {
+				continue
+			}
+			for _, elem := range arr {
+				var m bool
+				var err error
+				if ed, ok := elem.(bson.D); ok && !isOperatorDoc(sub) {
+					m, err = matches(ed, sub)
+				} else {
+					m, err = matchOperators([]interface{}{elem}, sub)
+				}
+				if err != nil {
+					return false, err
+				}
+				if m {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("mongowrappertest: unsupported query operator %s", op.Key)
+}
+
+func matchRegex(values []interface{}, pattern, opts string) bool {
+	flags := ""
+	for _, o := range opts {
+		if strings.ContainsRune("ims", o) {
+			flags += string(o)
+		}
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return false
+	}
+	for _, v := range expand(values) {
+		if s, ok := v.(string); ok && re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	}
+	if f, ok := toFloat(v); ok {
+		return f != 0
+	}
+	return true
+}
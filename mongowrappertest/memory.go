@@ -0,0 +1,621 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mongowrappertest provides helpers to test code built on
+// mongowrapper without a MongoDB server.
+package mongowrappertest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+)
+
+// ErrNotSupported is returned by the operations the in-memory backend does
+// not implement, such as Watch.
+var ErrNotSupported = errors.New("mongowrappertest: operation not supported")
+
+// Collection is an in-memory mongowrapper.CollectionBackend. It understands
+// the common query operators, the $set, $unset, $inc and $push update
+// operators and the $match, $sort, $skip, $limit, $project, $unwind, $group
+// and $count aggregation stages. Collation, hints and array filters are
+// ignored. It is safe for concurrent use.
+type Collection struct {
+	name string
+
+	mu   sync.Mutex
+	docs []bson.D
+}
+
+var _ mongowrapper.CollectionBackend = (*Collection)(nil)
+
+func NewCollection(name string) *Collection {
+	return &Collection{name: name}
+}
+
+// NewWrappedCollection returns a WrappedCollection backed by a new in-memory
+// Collection, so that its operations produce the usual spans and metrics.
+// Use the *Wrapped methods returning cursors and single results, such as
+// FindWrapped and FindOneWrapped, as the driver typed ones need the driver.
+func NewWrappedCollection(database, name string) *mongowrapper.WrappedCollection {
+	return mongowrapper.NewCollection(database, NewCollection(name))
+}
+
+func (c *Collection) Name() string { return c.name }
+
+func (c *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (mongowrapper.Cursor, error) {
+	stages, err := toDocs(pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := aggregate(c.snapshot(), stages)
+	if err != nil {
+		return nil, err
+	}
+	return newCursor(res)
+}
+
+func (c *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	ordered := true
+	for _, opt := range opts {
+		if opt != nil && opt.Ordered != nil {
+			ordered = *opt.Ordered
+		}
+	}
+
+	res := &mongo.BulkWriteResult{UpsertedIDs: make(map[int64]interface{})}
+	var bwe mongo.BulkWriteException
+	for i, model := range models {
+		err := c.writeModel(ctx, res, int64(i), model)
+		if err == nil {
+			continue
+		}
+		we := mongo.WriteError{Index: i, Message: err.Error()}
+		if wex, ok := err.(mongo.WriteException); ok && len(wex.WriteErrors) > 0 {
+			we = wex.WriteErrors[0]
+			we.Index = i
+		}
+		bwe.WriteErrors = append(bwe.WriteErrors, mongo.BulkWriteError{WriteError: we, Request: model})
+		if ordered {
+			break
+		}
+	}
+	if len(bwe.WriteErrors) > 0 {
+		return res, bwe
+	}
+	return res, nil
+}
+
+func (c *Collection) writeModel(ctx context.Context, res *mongo.BulkWriteResult, i int64, model mongo.WriteModel) error {
+	var ur *mongo.UpdateResult
+	var err error
+	switch m := model.(type) {
+	case *mongo.InsertOneModel:
+		if _, err = c.InsertOne(ctx, m.Document); err == nil {
+			res.InsertedCount++
+		}
+		return err
+	case *mongo.DeleteOneModel:
+		dr, err := c.DeleteOne(ctx, m.Filter)
+		if err == nil {
+			res.DeletedCount += dr.DeletedCount
+		}
+		return err
+	case *mongo.DeleteManyModel:
+		dr, err := c.DeleteMany(ctx, m.Filter)
+		if err == nil {
+			res.DeletedCount += dr.DeletedCount
+		}
+		return err
+	case *mongo.ReplaceOneModel:
+		ur, err = c.update(m.Filter, m.Replacement, false, true, m.Upsert != nil && *m.Upsert)
+	case *mongo.UpdateOneModel:
+		ur, err = c.update(m.Filter, m.Update, false, false, m.Upsert != nil && *m.Upsert)
+	case *mongo.UpdateManyModel:
+		ur, err = c.update(m.Filter, m.Update, true, false, m.Upsert != nil && *m.Upsert)
+	default:
+		return fmt.Errorf("mongowrappertest: unsupported write model %T", model)
+	}
+	if err != nil {
+		return err
+	}
+	res.MatchedCount += ur.MatchedCount
+	res.ModifiedCount += ur.ModifiedCount
+	if ur.UpsertedID != nil {
+		res.UpsertedCount++
+		res.UpsertedIDs[i] = ur.UpsertedID
+	}
+	return nil
+}
+
+func (c *Collection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	co := options.MergeCountOptions(opts...)
+	docs, err := c.query(filter, nil, co.Skip, co.Limit)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(docs)), nil
+}
+
+func (c *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	n, err := c.delete(filter, true)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: n}, nil
+}
+
+func (c *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	n, err := c.delete(filter, false)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.DeleteResult{DeletedCount: n}, nil
+}
+
+func (c *Collection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error) {
+	docs, err := c.query(filter, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []interface{}
+	for _, d := range docs {
+		for _, v := range expand(lookupPath(d, splitPath(fieldName))) {
+			if _, isArray := v.(bson.A); isArray {
+				continue
+			}
+			seen := false
+			for _, o := range out {
+				if equal(o, v) {
+					seen = true
+					break
+				}
+			}
+			if !seen {
+				out = append(out, v)
+			}
+		}
+	}
+	return out, nil
+}
+
+func (c *Collection) Drop(ctx context.Context) error {
+	c.mu.Lock()
+	c.docs = nil
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Collection) EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int64(len(c.docs)), nil
+}
+
+func (c *Collection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (mongowrapper.Cursor, error) {
+	fo := options.MergeFindOptions(opts...)
+	docs, err := c.query(filter, fo.Sort, fo.Skip, fo.Limit)
+	if err != nil {
+		return nil, err
+	}
+	if docs, err = projectAll(docs, fo.Projection); err != nil {
+		return nil, err
+	}
+	return newCursor(docs)
+}
+
+func (c *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) mongowrapper.SingleResult {
+	fo := options.MergeFindOneOptions(opts...)
+	one := int64(1)
+	docs, err := c.query(filter, fo.Sort, fo.Skip, &one)
+	if err == nil {
+		docs, err = projectAll(docs, fo.Projection)
+	}
+	return newSingleResult(firstDoc(docs), len(docs) > 0, err)
+}
+
+func (c *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) mongowrapper.SingleResult {
+	fo := options.MergeFindOneAndDeleteOptions(opts...)
+	doc, err := c.deleteOne(filter, fo.Sort)
+	if err != nil || doc == nil {
+		return newSingleResult(nil, false, err)
+	}
+	return projectedResult(doc, fo.Projection)
+}
+
+// deleteOne removes the first document matching filter in sort order and
+// returns it, or nil when nothing matched.
+func (c *Collection) deleteOne(filter, sort interface{}) (bson.D, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.firstMatch(filter, sort)
+	if err != nil || i < 0 {
+		return nil, err
+	}
+	doc := c.docs[i]
+	c.docs = append(c.docs[:i:i], c.docs[i+1:]...)
+	return doc, nil
+}
+
+func (c *Collection) FindOneAndReplace(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) mongowrapper.SingleResult {
+	fo := options.MergeFindOneAndReplaceOptions(opts...)
+	return c.findOneAndModify(filter, replacement, true, fo.Sort, fo.Projection, fo.ReturnDocument, fo.Upsert)
+}
+
+func (c *Collection) FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) mongowrapper.SingleResult {
+	fo := options.MergeFindOneAndUpdateOptions(opts...)
+	return c.findOneAndModify(filter, update, false, fo.Sort, fo.Projection, fo.ReturnDocument, fo.Upsert)
+}
+
+func (c *Collection) findOneAndModify(filter, update interface{}, replace bool, sort, projection interface{}, rd *options.ReturnDocument, upsert *bool) mongowrapper.SingleResult {
+	returnAfter := rd != nil && *rd == options.After
+	doc, _, err := c.modifyOne(filter, update, replace, sort, returnAfter, upsert != nil && *upsert)
+	if err != nil || doc == nil {
+		return newSingleResult(nil, false, err)
+	}
+	return projectedResult(doc, projection)
+}
+
+// modifyOne updates or replaces the first document matching filter in sort
+// order. It returns the document as it was before the change, or after it
+// when returnAfter is set, and whether an existing document matched; the
+// match and the write happen under one lock.
+func (c *Collection) modifyOne(filter, update interface{}, replace bool, sort interface{}, returnAfter, upsert bool) (doc bson.D, existed bool, err error) {
+	fd, err := toDoc(filter)
+	if err != nil {
+		return nil, false, err
+	}
+	ud, err := toDoc(update)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, err := c.firstMatch(fd, sort)
+	if err != nil {
+		return nil, false, err
+	}
+	if i < 0 {
+		if !upsert {
+			return nil, false, nil
+		}
+		doc, err := c.upsertLocked(fd, ud, replace)
+		if err != nil || !returnAfter {
+			return nil, false, err
+		}
+		return doc, false, nil
+	}
+
+	before := c.docs[i]
+	after, err := modify(before, ud, replace)
+	if err != nil {
+		return nil, true, err
+	}
+	c.docs[i] = after
+	if returnAfter {
+		return after, true, nil
+	}
+	return before, true, nil
+}
+
+func (c *Collection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	ordered := true
+	if io := options.MergeInsertManyOptions(opts...); io.Ordered != nil {
+		ordered = *io.Ordered
+	}
+
+	res := &mongo.InsertManyResult{}
+	var bwe mongo.BulkWriteException
+	for i, doc := range documents {
+		ir, err := c.InsertOne(ctx, doc)
+		if err == nil {
+			res.InsertedIDs = append(res.InsertedIDs, ir.InsertedID)
+			continue
+		}
+		we := mongo.WriteError{Index: i, Message: err.Error()}
+		if wex, ok := err.(mongo.WriteException); ok && len(wex.WriteErrors) > 0 {
+			we = wex.WriteErrors[0]
+			we.Index = i
+		}
+		bwe.WriteErrors = append(bwe.WriteErrors, mongo.BulkWriteError{WriteError: we, Request: &mongo.InsertOneModel{Document: doc}})
+		if ordered {
+			break
+		}
+	}
+	if len(bwe.WriteErrors) > 0 {
+		return res, bwe
+	}
+	return res, nil
+}
+
+func (c *Collection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
+	doc, err := toDoc(document)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id, err := c.insertLocked(doc)
+	if err != nil {
+		return nil, err
+	}
+	return &mongo.InsertOneResult{InsertedID: id}, nil
+}
+
+func (c *Collection) ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	ro := options.MergeReplaceOptions(opts...)
+	return c.update(filter, replacement, false, true, ro.Upsert != nil && *ro.Upsert)
+}
+
+func (c *Collection) UpdateMany(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	uo := options.MergeUpdateOptions(opts...)
+	return c.update(filter, update, true, false, uo.Upsert != nil && *uo.Upsert)
+}
+
+func (c *Collection) UpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	uo := options.MergeUpdateOptions(opts...)
+	return c.update(filter, update, false, false, uo.Upsert != nil && *uo.Upsert)
+}
+
+func (c *Collection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	return nil, ErrNotSupported
+}
+
+// snapshot returns the current documents; the documents themselves are never
+// modified in place, so they may be read without holding c.mu.
+func (c *Collection) snapshot() []bson.D {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]bson.D(nil), c.docs...)
+}
+
+// query returns the documents matching filter, sorted, skipped and limited.
+func (c *Collection) query(filter, sort interface{}, skip, limit *int64) ([]bson.D, error) {
+	fd, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	docs, err := filterDocs(c.docs, fd)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if sort != nil {
+		sd, err := toDoc(sort)
+		if err != nil {
+			return nil, err
+		}
+		if err := sortDocs(docs, sd); err != nil {
+			return nil, err
+		}
+	}
+	if skip != nil {
+		docs = skipDocs(docs, *skip)
+	}
+	if limit != nil {
+		docs = limitDocs(docs, *limit)
+	}
+	return docs, nil
+}
+
+// firstMatch returns the index of the first document matching filter in
+// sort order, or -1. c.mu must be held.
+func (c *Collection) firstMatch(filter, sort interface{}) (int, error) {
+	fd, err := toDoc(filter)
+	if err != nil {
+		return -1, err
+	}
+	var sd bson.D
+	if sort != nil {
+		if sd, err = toDoc(sort); err != nil {
+			return -1, err
+		}
+	}
+
+	best := -1
+	for i, d := range c.docs {
+		m, err := matches(d, fd)
+		if err != nil {
+			return -1, err
+		}
+		if !m {
+			continue
+		}
+		if len(sd) == 0 {
+			return i, nil
+		}
+		if best < 0 {
+			best = i
+			continue
+		}
+		pair := []bson.D{c.docs[best], d}
+		if err := sortDocs(pair, sd); err != nil {
+			return -1, err
+		}
+		if equal(pair[0], d) && !equal(pair[0], c.docs[best]) {
+			best = i
+		}
+	}
+	return best, nil
+}
+
+func (c *Collection) update(filter, update interface{}, multi, replace, upsert bool) (*mongo.UpdateResult, error) {
+	fd, err := toDoc(filter)
+	if err != nil {
+		return nil, err
+	}
+	ud, err := toDoc(update)
+	if err != nil {
+		return nil, err
+	}
+	if !replace && !isUpdateDoc(ud) {
+		return nil, errors.New("mongowrappertest: update document must contain update operators")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := &mongo.UpdateResult{}
+	for i, d := range c.docs {
+		m, err := matches(d, fd)
+		if err != nil {
+			return nil, err
+		}
+		if !m {
+			continue
+		}
+		after, err := modify(d, ud, replace)
+		if err != nil {
+			return nil, err
+		}
+		res.MatchedCount++
+		if !equal(d, after) {
+			res.ModifiedCount++
+			c.docs[i] = after
+		}
+		if !multi {
+			break
+		}
+	}
+
+	if res.MatchedCount == 0 && upsert {
+		doc, err := c.upsertLocked(fd, ud, replace)
+		if err != nil {
+			return nil, err
+		}
+		res.UpsertedCount = 1
+		res.UpsertedID, _ = lookupKey(doc, "_id")
+	}
+	return res, nil
+}
+
+func modify(doc, update bson.D, replace bool) (bson.D, error) {
+	if replace {
+		return replaceDoc(doc, update)
+	}
+	return applyUpdate(doc, update)
+}
+
+// upsertLocked inserts the document described by an upsert. c.mu must be
+// held.
+func (c *Collection) upsertLocked(filter, update bson.D, replace bool) (bson.D, error) {
+	seed := upsertSeed(filter)
+	var doc bson.D
+	var err error
+	if replace {
+		id, _ := lookupKey(seed, "_id")
+		if rid, ok := lookupKey(update, "_id"); ok {
+			id = rid
+		}
+		doc, err = replaceDoc(bson.D{{Key: "_id", Value: id}}, update)
+		if id == nil {
+			doc = doc[1:]
+		}
+	} else {
+		doc, err = applyUpdate(seed, update)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.insertLocked(doc); err != nil {
+		return nil, err
+	}
+	return c.docs[len(c.docs)-1], nil
+}
+
+// insertLocked stores doc, giving it an ObjectID _id if it has none. c.mu
+// must be held.
+func (c *Collection) insertLocked(doc bson.D) (interface{}, error) {
+	id, ok := lookupKey(doc, "_id")
+	if !ok {
+		id = primitive.NewObjectID()
+		doc = append(bson.D{{Key: "_id", Value: id}}, doc...)
+	}
+	for _, d := range c.docs {
+		if did, _ := lookupKey(d, "_id"); equal(did, id) {
+			return nil, mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+				Code:    11000,
+				Message: fmt.Sprintf("E11000 duplicate key error collection: %s index: _id_ dup key: { _id: %v }", c.name, id),
+			}}}
+		}
+	}
+	c.docs = append(c.docs, doc)
+	return id, nil
+}
+
+func (c *Collection) delete(filter interface{}, multi bool) (int64, error) {
+	fd, err := toDoc(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var n int64
+	kept := c.docs[:0:0]
+	for _, d := range c.docs {
+		m, err := matches(d, fd)
+		if err != nil {
+			return 0, err
+		}
+		if m && (multi || n == 0) {
+			n++
+			continue
+		}
+		kept = append(kept, d)
+	}
+	c.docs = kept
+	return n, nil
+}
+
+func projectAll(docs []bson.D, projection interface{}) ([]bson.D, error) {
+	if projection == nil {
+		return docs, nil
+	}
+	pd, err := toDoc(projection)
+	if err != nil {
+		return nil, err
+	}
+	return projectDocs(docs, pd)
+}
+
+func projectedResult(doc bson.D, projection interface{}) mongowrapper.SingleResult {
+	docs, err := projectAll([]bson.D{doc}, projection)
+	return newSingleResult(firstDoc(docs), err == nil, err)
+}
+
+func firstDoc(docs []bson.D) bson.D {
+	if len(docs) == 0 {
+		return nil
+	}
+	return docs[0]
+}
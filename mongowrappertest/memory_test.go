@@ -0,0 +1,113 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestCollectionCRUD(t *testing.T) {
+	ctx := context.Background()
+	coll := NewWrappedCollection("db", "music")
+
+	_, err := coll.InsertMany(ctx, []interface{}{
+		bson.D{{Key: "_id", Value: 1}, {Key: "name", Value: "a"}, {Key: "plays", Value: 3}},
+		bson.D{{Key: "_id", Value: 2}, {Key: "name", Value: "b"}, {Key: "plays", Value: 7}},
+		bson.D{{Key: "_id", Value: 3}, {Key: "name", Value: "c"}, {Key: "plays", Value: 5}},
+	})
+	if err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	_, err = coll.InsertOne(ctx, bson.D{{Key: "_id", Value: 1}})
+	if we, ok := err.(mongo.WriteException); !ok || we.WriteErrors[0].Code != 11000 {
+		t.Fatalf("InsertOne duplicate: got %v, want a duplicate key error", err)
+	}
+
+	cur, err := coll.FindWrapped(ctx, bson.M{"plays": bson.M{"$gte": 5}}, options.Find().SetSort(bson.M{"plays": -1}))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []struct{ Name string }
+	if err := cur.All(ctx, &got); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(got) != 2 || got[0].Name != "b" || got[1].Name != "c" {
+		t.Fatalf("Find: got %v, want [b c]", got)
+	}
+
+	ur, err := coll.UpdateMany(ctx, bson.M{}, bson.M{"$inc": bson.M{"plays": 1}})
+	if err != nil || ur.MatchedCount != 3 || ur.ModifiedCount != 3 {
+		t.Fatalf("UpdateMany: got %+v, %v", ur, err)
+	}
+	ur, err = coll.UpdateOne(ctx, bson.M{"name": "d"}, bson.M{"$set": bson.M{"plays": 1}}, options.Update().SetUpsert(true))
+	if err != nil || ur.UpsertedID == nil {
+		t.Fatalf("UpdateOne upsert: got %+v, %v", ur, err)
+	}
+
+	var doc struct{ Plays int }
+	err = coll.FindOneAndUpdateWrapped(ctx, bson.M{"name": "a"}, bson.M{"$inc": bson.M{"plays": 10}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if err != nil || doc.Plays != 14 {
+		t.Fatalf("FindOneAndUpdate: got %+v, %v", doc, err)
+	}
+	if err := coll.FindOneWrapped(ctx, bson.M{"name": "zzz"}).Err(); err != mongo.ErrNoDocuments {
+		t.Fatalf("FindOne: got %v, want ErrNoDocuments", err)
+	}
+
+	dr, err := coll.DeleteMany(ctx, bson.M{"plays": bson.M{"$lt": 7}})
+	if err != nil || dr.DeletedCount != 2 {
+		t.Fatalf("DeleteMany: got %+v, %v", dr, err)
+	}
+	if n, err := coll.CountDocuments(ctx, bson.M{}); err != nil || n != 2 {
+		t.Fatalf("CountDocuments: got %d, %v", n, err)
+	}
+}
+
+func TestCollectionAggregate(t *testing.T) {
+	ctx := context.Background()
+	coll := NewWrappedCollection("db", "orders")
+	for _, d := range []bson.M{
+		{"customer": "x", "total": 10},
+		{"customer": "y", "total": 5},
+		{"customer": "x", "total": 20},
+	} {
+		if _, err := coll.InsertOne(ctx, d); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+
+	cur, err := coll.AggregateWrapped(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$customer", "sum": bson.M{"$sum": "$total"}}}},
+		{{Key: "$sort", Value: bson.M{"sum": -1}}},
+	})
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	var got []struct {
+		ID  string `bson:"_id"`
+		Sum int
+	}
+	if err := cur.All(ctx, &got); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "x" || got[0].Sum != 30 || got[1].Sum != 5 {
+		t.Fatalf("Aggregate: got %+v", got)
+	}
+}
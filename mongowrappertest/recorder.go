@@ -0,0 +1,197 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+)
+
+const methodPrefix = "go.mongodb.org/mongo-driver."
+
+// Recorder captures the spans and view data produced by mongowrapper so that
+// tests can assert on them without waiting for a reporting period.
+//
+// Spans are captured as they end. View data is read on demand through
+// view.RetrieveData, which is served by the same worker that processes
+// stats.Record and therefore already reflects every measurement recorded
+// before the call. The trace exporter, sampler and views are process-wide,
+// so tests using a Recorder must not run in parallel.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+
+	hadViews bool
+}
+
+var _ trace.Exporter = (*Recorder)(nil)
+
+// StartRecorder registers a Recorder as a trace exporter, samples every span
+// and registers the mongowrapper views. Call Stop once the test is done.
+func StartRecorder() (*Recorder, error) {
+	r := &Recorder{hadViews: view.Find("mongo/client/calls") != nil}
+	if !r.hadViews {
+		if err := mongowrapper.RegisterAllViews(); err != nil {
+			return nil, err
+		}
+	}
+	trace.RegisterExporter(r)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	return r, nil
+}
+
+// Stop unregisters the exporter and restores trace.ProbabilitySampler(1e-4),
+// the default sampler of the trace package, which cannot tell the sampler
+// in effect when the recorder started. The mongowrapper views are
+// unregistered, discarding their data, unless they were already registered
+// then.
+func (r *Recorder) Stop() {
+	trace.UnregisterExporter(r)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+	if !r.hadViews {
+		mongowrapper.UnregisterAllViews()
+	}
+}
+
+// Reset drops the spans recorded so far and zeroes every view.
+func (r *Recorder) Reset() error {
+	r.mu.Lock()
+	r.spans = nil
+	r.mu.Unlock()
+
+	mongowrapper.UnregisterAllViews()
+	return mongowrapper.RegisterAllViews()
+}
+
+func (r *Recorder) ExportSpan(sd *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, sd)
+}
+
+// Spans returns the spans ended since the recorder started, in order.
+func (r *Recorder) Spans() []*trace.SpanData {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*trace.SpanData(nil), r.spans...)
+}
+
+// SpansNamed returns the recorded spans for method, which may be given
+// either in full or without the "go.mongodb.org/mongo-driver." prefix.
+func (r *Recorder) SpansNamed(method string) []*trace.SpanData {
+	var out []*trace.SpanData
+	for _, sd := range r.Spans() {
+		if sameMethod(sd.Name, method) {
+			out = append(out, sd)
+		}
+	}
+	return out
+}
+
+// Rows returns the current data of the named view.
+func (r *Recorder) Rows(viewName string) ([]*view.Row, error) {
+	return view.RetrieveData(viewName)
+}
+
+// Calls returns how many calls to method were counted by the
+// "mongo/client/calls" view, whatever their outcome.
+func (r *Recorder) Calls(method string) (int64, error) {
+	rows, err := r.Rows("mongo/client/calls")
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, row := range rows {
+		for _, t := range row.Tags {
+			if t.Key.Name() == "method" && sameMethod(t.Value, method) {
+				n += row.Data.(*view.CountData).Value
+			}
+		}
+	}
+	return n, nil
+}
+
+// AssertSpan fails the test unless a span for method was recorded with the
+// given status code and at least the given attributes. It returns the first
+// matching span.
+func (r *Recorder) AssertSpan(t testing.TB, method string, attrs map[string]interface{}, code int32) *trace.SpanData {
+	t.Helper()
+
+	spans := r.SpansNamed(method)
+	for _, sd := range spans {
+		if sd.Code == code && hasAttributes(sd.Attributes, attrs) {
+			return sd
+		}
+	}
+
+	var got []string
+	for _, sd := range spans {
+		got = append(got, fmt.Sprintf("{code: %d, attributes: %v}", sd.Code, sd.Attributes))
+	}
+	t.Errorf("no span %q with code %d and attributes %v; got %d span(s) with that name: %s",
+		method, code, attrs, len(spans), strings.Join(got, ", "))
+	return nil
+}
+
+// AssertCalls fails the test unless the calls view counted want calls to
+// method.
+func (r *Recorder) AssertCalls(t testing.TB, method string, want int64) {
+	t.Helper()
+
+	got, err := r.Calls(method)
+	if err != nil {
+		t.Errorf("retrieving calls for %q: %v", method, err)
+		return
+	}
+	if got != want {
+		t.Errorf("calls for %q: got %d, want %d", method, got, want)
+	}
+}
+
+func sameMethod(name, method string) bool {
+	return name == method || strings.TrimPrefix(name, methodPrefix) == method
+}
+
+func hasAttributes(got, want map[string]interface{}) bool {
+	for k, w := range want {
+		g, ok := got[k]
+		if !ok || !reflect.DeepEqual(g, attributeValue(w)) {
+			return false
+		}
+	}
+	return true
+}
+
+// attributeValue converts v to the type trace stores attributes as, so that
+// untyped constants compare equal.
+func attributeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	}
+	return v
+}
@@ -0,0 +1,74 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+)
+
+func TestRecorder(t *testing.T) {
+	rec, err := StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	ctx := context.Background()
+	coll := NewWrappedCollection("db", "music")
+	for i := 0; i < 3; i++ {
+		if _, err := coll.InsertOne(ctx, bson.M{"_id": i}); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 0}); err == nil {
+		t.Fatal("InsertOne: expected a duplicate key error")
+	}
+
+	rec.AssertSpan(t, "Collection.InsertOne", nil, trace.StatusCodeOK)
+	rec.AssertSpan(t, "go.mongodb.org/mongo-driver.Collection.InsertOne", nil, trace.StatusCodeUnknown)
+	rec.AssertCalls(t, "Collection.InsertOne", 4)
+
+	if err := rec.Reset(); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if len(rec.Spans()) != 0 {
+		t.Errorf("Spans after Reset: got %d, want 0", len(rec.Spans()))
+	}
+	rec.AssertCalls(t, "Collection.InsertOne", 0)
+}
+
+func TestRecorderStopKeepsViews(t *testing.T) {
+	if err := mongowrapper.RegisterAllViews(); err != nil {
+		t.Fatalf("RegisterAllViews: %v", err)
+	}
+	defer mongowrapper.UnregisterAllViews()
+
+	rec, err := StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	rec.Stop()
+
+	if view.Find("mongo/client/calls") == nil {
+		t.Error("Stop unregistered views registered before the recorder started")
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/wiremessage"
+)
+
+const maxMessageSize = 48000000
+
+// Server is an in-process MongoDB stand-in listening on a loopback TCP port.
+// It speaks enough of the wire protocol (OP_QUERY for the handshake, OP_MSG
+// afterwards) for a WrappedClient to connect to it and run the common CRUD
+// commands against in-memory Collections. It reports itself as a standalone
+// server, so transactions are accepted but not isolated, and change streams
+// only report the documents present when they are opened.
+type Server struct {
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu           sync.Mutex
+	conns        map[net.Conn]bool
+	collections  map[string]*Collection
+	indexes      map[string][]bson.D // by namespace, besides the _id one
+	cursors      map[int64]*serverCursor
+	lastCursorID int64
+	closed       bool
+
+	handle func(db string, cmd bson.D) bson.D
+	replay *replayer
+}
+
+// NewServer starts a Server on an ephemeral loopback port. Close it once
+// the test is done.
+func NewServer() (*Server, error) {
+	s, err := listen()
+	if err != nil {
+		return nil, err
+	}
+	s.handle = s.runCommand
+	s.start()
+	return s, nil
+}
+
+func listen() (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return &Server{
+		ln:          ln,
+		conns:       make(map[net.Conn]bool),
+		collections: make(map[string]*Collection),
+		indexes:     make(map[string][]bson.D),
+		cursors:     make(map[int64]*serverCursor),
+	}, nil
+}
+
+func (s *Server) start() {
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string { return s.ln.Addr().String() }
+
+// URI returns a connection string for the server, suitable for
+// options.Client().ApplyURI.
+func (s *Server) URI() string { return "mongodb://" + s.Addr() + "/?connect=direct" }
+
+// Collection returns the in-memory collection backing database.name,
+// creating it if needed, so that tests can seed or inspect its contents.
+func (s *Server) Collection(database, name string) *Collection {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ns := database + "." + name
+	c, ok := s.collections[ns]
+	if !ok {
+		c = NewCollection(name)
+		s.collections[ns] = c
+	}
+	return c
+}
+
+// Close stops the listener, drops every open connection and waits for the
+// connection handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	err := s.ln.Close()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[conn] = true
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		wm, err := readWireMessage(r)
+		if err != nil {
+			return
+		}
+		reply, err := s.handleMessage(wm)
+		if err != nil {
+			return
+		}
+		if reply == nil {
+			continue
+		}
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+func readWireMessage(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := int32(binary.LittleEndian.Uint32(size[:]))
+	if n < 16 || n > maxMessageSize {
+		return nil, fmt.Errorf("mongowrappertest: invalid message length %d", n)
+	}
+	wm := make([]byte, n)
+	copy(wm, size[:])
+	if _, err := io.ReadFull(r, wm[4:]); err != nil {
+		return nil, err
+	}
+	return wm, nil
+}
+
+// handleMessage decodes a request and returns the encoded reply, or nil when
+// the client asked not to get one.
+func (s *Server) handleMessage(wm []byte) ([]byte, error) {
+	_, reqID, _, opcode, rem, ok := wiremessage.ReadHeader(wm)
+	if !ok {
+		return nil, errors.New("mongowrappertest: malformed message header")
+	}
+
+	switch opcode {
+	case wiremessage.OpQuery:
+		ns, cmd, err := readQuery(rem)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasSuffix(ns, ".$cmd") {
+			return nil, fmt.Errorf("mongowrappertest: legacy query on %q is not supported", ns)
+		}
+		reply, err := bson.Marshal(s.handle(strings.TrimSuffix(ns, ".$cmd"), cmd))
+		if err != nil {
+			return nil, err
+		}
+		return appendReply(reqID, reply), nil
+
+	case wiremessage.OpMsg:
+		flags, cmd, err := readMsg(rem)
+		if err != nil {
+			return nil, err
+		}
+		db, _ := lookupKey(cmd, "$db")
+		dbName, _ := db.(string)
+		reply, err := bson.Marshal(s.handle(dbName, cmd))
+		if err != nil {
+			return nil, err
+		}
+		if flags&wiremessage.MoreToCome != 0 {
+			return nil, nil
+		}
+		return appendMsg(reqID, reply), nil
+	}
+	return nil, fmt.Errorf("mongowrappertest: unsupported opcode %v", opcode)
+}
+
+func readQuery(src []byte) (string, bson.D, error) {
+	_, src, ok := wiremessage.ReadQueryFlags(src)
+	if !ok {
+		return "", nil, errors.New("mongowrappertest: malformed OP_QUERY")
+	}
+	ns, src, ok := wiremessage.ReadQueryFullCollectionName(src)
+	if !ok {
+		return "", nil, errors.New("mongowrappertest: malformed OP_QUERY")
+	}
+	if _, src, ok = wiremessage.ReadQueryNumberToSkip(src); !ok {
+		return "", nil, errors.New("mongowrappertest: malformed OP_QUERY")
+	}
+	if _, src, ok = wiremessage.ReadQueryNumberToReturn(src); !ok {
+		return "", nil, errors.New("mongowrappertest: malformed OP_QUERY")
+	}
+	query, _, ok := wiremessage.ReadQueryQuery(src)
+	if !ok {
+		return "", nil, errors.New("mongowrappertest: malformed OP_QUERY")
+	}
+
+	var cmd bson.D
+	if err := bson.Unmarshal(query, &cmd); err != nil {
+		return "", nil, err
+	}
+	// Commands sent to a mongos are wrapped as {$query: cmd, $readPreference: …}.
+	if len(cmd) > 0 && cmd[0].Key == "$query" {
+		if inner, ok := cmd[0].Value.(bson.D); ok {
+			cmd = inner
+		}
+	}
+	return ns, cmd, nil
+}
+
+// readMsg returns the command of an OP_MSG, with the document sequences
+// folded back into it as array fields.
+func readMsg(src []byte) (wiremessage.MsgFlag, bson.D, error) {
+	flags, src, ok := wiremessage.ReadMsgFlags(src)
+	if !ok {
+		return 0, nil, errors.New("mongowrappertest: malformed OP_MSG")
+	}
+	if flags&wiremessage.ChecksumPresent != 0 && len(src) >= 4 {
+		src = src[:len(src)-4]
+	}
+
+	var cmd bson.D
+	var seqs bson.D
+	for len(src) > 0 {
+		var stype wiremessage.SectionType
+		stype, src, ok = wiremessage.ReadMsgSectionType(src)
+		if !ok {
+			return 0, nil, errors.New("mongowrappertest: malformed OP_MSG section")
+		}
+		switch stype {
+		case wiremessage.SingleDocument:
+			var body bsoncore.Document
+			if body, src, ok = wiremessage.ReadMsgSectionSingleDocument(src); !ok {
+				return 0, nil, errors.New("mongowrappertest: malformed OP_MSG body")
+			}
+			if err := bson.Unmarshal(body, &cmd); err != nil {
+				return 0, nil, err
+			}
+		case wiremessage.DocumentSequence:
+			var id string
+			var docs []bsoncore.Document
+			if id, docs, src, ok = wiremessage.ReadMsgSectionDocumentSequence(src); !ok {
+				return 0, nil, errors.New("mongowrappertest: malformed OP_MSG document sequence")
+			}
+			arr := make(bson.A, 0, len(docs))
+			for _, raw := range docs {
+				var d bson.D
+				if err := bson.Unmarshal(raw, &d); err != nil {
+					return 0, nil, err
+				}
+				arr = append(arr, d)
+			}
+			seqs = append(seqs, bson.E{Key: id, Value: arr})
+		default:
+			return 0, nil, fmt.Errorf("mongowrappertest: unknown OP_MSG section type %d", stype)
+		}
+	}
+	return flags, append(cmd, seqs...), nil
+}
+
+func appendReply(responseTo int32, doc []byte) []byte {
+	idx, wm := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), responseTo, wiremessage.OpReply)
+	wm = wiremessage.AppendReplyFlags(wm, 0)
+	wm = wiremessage.AppendReplyCursorID(wm, 0)
+	wm = wiremessage.AppendReplyStartingFrom(wm, 0)
+	wm = wiremessage.AppendReplyNumberReturned(wm, 1)
+	wm = append(wm, doc...)
+	return bsoncore.UpdateLength(wm, idx, int32(len(wm[idx:])))
+}
+
+func appendMsg(responseTo int32, doc []byte) []byte {
+	idx, wm := wiremessage.AppendHeaderStart(nil, wiremessage.NextRequestID(), responseTo, wiremessage.OpMsg)
+	wm = wiremessage.AppendMsgFlags(wm, 0)
+	wm = wiremessage.AppendMsgSectionType(wm, wiremessage.SingleDocument)
+	wm = append(wm, doc...)
+	return bsoncore.UpdateLength(wm, idx, int32(len(wm[idx:])))
+}
@@ -0,0 +1,154 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+)
+
+func TestServerWithWrappedClient(t *testing.T) {
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	coll := client.Database("the_db").Collection("music")
+	var docs []interface{}
+	for i := 0; i < 10; i++ {
+		docs = append(docs, bson.M{"_id": i, "plays": i * 10})
+	}
+	if _, err := coll.InsertMany(ctx, docs); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	_, err = coll.InsertOne(ctx, bson.M{"_id": 3})
+	if we, ok := err.(mongo.WriteException); !ok || len(we.WriteErrors) != 1 || we.WriteErrors[0].Code != 11000 {
+		t.Fatalf("InsertOne duplicate: got %v, want a duplicate key error", err)
+	}
+
+	// A small batch size makes the driver go through getMore.
+	cur, err := coll.Find(ctx, bson.M{"plays": bson.M{"$gte": 30}}, options.Find().SetBatchSize(2).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var got []struct {
+		ID int `bson:"_id"`
+	}
+	if err := cur.All(ctx, &got); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(got) != 7 || got[0].ID != 3 || got[6].ID != 9 {
+		t.Fatalf("Find: got %v, want ids 3 through 9", got)
+	}
+
+	// Closing a cursor that still has batches left sends killCursors.
+	cur, err = coll.Find(ctx, bson.M{}, options.Find().SetBatchSize(2))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	if err := cur.Close(ctx); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	ur, err := coll.UpdateMany(ctx, bson.M{"plays": bson.M{"$lt": 30}}, bson.M{"$set": bson.M{"cold": true}})
+	if err != nil || ur.MatchedCount != 3 || ur.ModifiedCount != 3 {
+		t.Fatalf("UpdateMany: got %+v, %v", ur, err)
+	}
+	ur, err = coll.UpdateOne(ctx, bson.M{"_id": 42}, bson.M{"$set": bson.M{"plays": 1}}, options.Update().SetUpsert(true))
+	if err != nil || ur.UpsertedID == nil {
+		t.Fatalf("UpdateOne upsert: got %+v, %v", ur, err)
+	}
+
+	dr, err := coll.DeleteMany(ctx, bson.M{"cold": true})
+	if err != nil || dr.DeletedCount != 3 {
+		t.Fatalf("DeleteMany: got %+v, %v", dr, err)
+	}
+	if n, err := coll.CountDocuments(ctx, bson.M{"plays": bson.M{"$gt": 50}}); err != nil || n != 4 {
+		t.Fatalf("CountDocuments: got %d, %v; want 4", n, err)
+	}
+	var doc struct{ Plays int }
+	err = coll.FindOneAndUpdate(ctx, bson.M{"_id": 42}, bson.M{"$inc": bson.M{"plays": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&doc)
+	if err != nil || doc.Plays != 2 {
+		t.Fatalf("FindOneAndUpdate: got %+v, %v", doc, err)
+	}
+	if n, err := srv.Collection("the_db", "music").EstimatedDocumentCount(ctx); err != nil || n != 8 {
+		t.Fatalf("server collection: got %d documents, %v; want 8", n, err)
+	}
+}
+
+func TestFindAndModifyConcurrentRemoves(t *testing.T) {
+	coll := NewCollection("c")
+	const docs = 20
+	for i := 0; i < docs; i++ {
+		if _, err := coll.InsertOne(context.Background(), bson.D{{Key: "_id", Value: i}}); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+
+	var mu sync.Mutex
+	removed := 0
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < docs; i++ {
+				reply := findAndModify(coll, bson.D{
+					{Key: "findAndModify", Value: "c"},
+					{Key: "query", Value: bson.D{}},
+					{Key: "remove", Value: true},
+				})
+				leo, _ := lookupKey(reply, "lastErrorObject")
+				n, _ := lookupKey(leo.(bson.D), "n")
+				value, _ := lookupKey(reply, "value")
+				if (n.(int32) == 1) != (value != nil) {
+					t.Errorf("n = %v with value %v", n, value)
+				}
+				mu.Lock()
+				removed += int(n.(int32))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if removed != docs {
+		t.Errorf("removed %d documents, want %d", removed, docs)
+	}
+}
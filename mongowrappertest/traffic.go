@@ -0,0 +1,287 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+)
+
+// TrafficRecorder writes every command a client sends, together with its
+// reply, to an io.Writer as canonical extended JSON, one exchange per line:
+//
+//	{"db": "the_db", "command": {...}, "reply": {...}}
+//
+// Attach it with options.Client().SetMonitor(tr.Monitor()) and replay the
+// log with NewReplayServer. Commands that fail client side or with ok: 0 are
+// recorded with a reply rebuilt from the failure message, as the driver does
+// not report the server's reply for them; the message only carries the code
+// name, so also install Interceptor on the client to record the code and
+// error labels.
+type TrafficRecorder struct {
+	mu      sync.Mutex
+	w       io.Writer
+	started map[int64]*event.CommandStartedEvent
+	err     error
+}
+
+func NewTrafficRecorder(w io.Writer) *TrafficRecorder {
+	return &TrafficRecorder{w: w, started: make(map[int64]*event.CommandStartedEvent)}
+}
+
+// Monitor returns the command monitor feeding the recorder.
+func (tr *TrafficRecorder) Monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started: func(_ context.Context, evt *event.CommandStartedEvent) {
+			tr.mu.Lock()
+			tr.started[evt.RequestID] = evt
+			tr.mu.Unlock()
+		},
+		Succeeded: func(ctx context.Context, evt *event.CommandSucceededEvent) {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			tr.flushLocked(ctx)
+			tr.finishLocked(evt.RequestID, evt.Reply)
+		},
+		Failed: func(ctx context.Context, evt *event.CommandFailedEvent) {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			tr.flushLocked(ctx)
+			if pf, ok := ctx.Value(pendingFailureKey{}).(*pendingFailure); ok {
+				pf.requestID, pf.failure = evt.RequestID, evt.Failure
+				return
+			}
+			tr.finishLocked(evt.RequestID, failureReply(evt.Failure, nil))
+		},
+	}
+}
+
+// Interceptor returns an interceptor that completes the reply recorded for
+// the last failed command of each operation with the code and error labels
+// of the error the operation returns.
+func (tr *TrafficRecorder) Interceptor() mongowrapper.Interceptor {
+	return func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		pf := new(pendingFailure)
+		err := invoke(context.WithValue(ctx, pendingFailureKey{}, pf), op)
+
+		tr.mu.Lock()
+		defer tr.mu.Unlock()
+		if pf.failure != "" {
+			tr.finishLocked(pf.requestID, failureReply(pf.failure, err))
+			pf.failure = ""
+		}
+		return err
+	}
+}
+
+// pendingFailure holds the failed command of an operation until the
+// operation returns its error. Commands are retried within the operation, so
+// a later command of the same operation records it as it is.
+type pendingFailure struct {
+	requestID int64
+	failure   string
+}
+
+type pendingFailureKey struct{}
+
+// flushLocked records the failed command held for the operation of ctx, if
+// any. tr.mu must be held.
+func (tr *TrafficRecorder) flushLocked(ctx context.Context) {
+	if pf, ok := ctx.Value(pendingFailureKey{}).(*pendingFailure); ok && pf.failure != "" {
+		tr.finishLocked(pf.requestID, failureReply(pf.failure, nil))
+		pf.failure = ""
+	}
+}
+
+// failureReply rebuilds the reply of a failed command from its failure
+// message, which is formatted as "(CodeName) message", and from err when it
+// is the command error the message was made of.
+func failureReply(failure string, err error) bson.Raw {
+	reply := bson.D{{Key: "ok", Value: 0.0}}
+	if ce, ok := err.(mongo.CommandError); ok && ce.Error() == failure {
+		reply = append(reply, bson.E{Key: "errmsg", Value: ce.Message}, bson.E{Key: "code", Value: ce.Code})
+		if ce.Name != "" {
+			reply = append(reply, bson.E{Key: "codeName", Value: ce.Name})
+		}
+		if len(ce.Labels) > 0 {
+			reply = append(reply, bson.E{Key: "errorLabels", Value: ce.Labels})
+		}
+	} else if i := strings.Index(failure, ") "); strings.HasPrefix(failure, "(") && i > 0 {
+		reply = append(reply, bson.E{Key: "errmsg", Value: failure[i+2:]}, bson.E{Key: "codeName", Value: failure[1:i]})
+	} else {
+		reply = append(reply, bson.E{Key: "errmsg", Value: failure})
+	}
+	raw, _ := bson.Marshal(reply)
+	return raw
+}
+
+// Err returns the first error met while writing the log.
+func (tr *TrafficRecorder) Err() error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.err
+}
+
+// finishLocked writes the exchange of the command with requestID. tr.mu must
+// be held.
+func (tr *TrafficRecorder) finishLocked(requestID int64, reply bson.Raw) {
+	started, ok := tr.started[requestID]
+	if !ok {
+		return
+	}
+	delete(tr.started, requestID)
+	if tr.err != nil || isHandshake(started.CommandName) {
+		return
+	}
+
+	line, err := bson.MarshalExtJSON(bson.D{
+		{Key: "db", Value: started.DatabaseName},
+		{Key: "command", Value: started.Command},
+		{Key: "reply", Value: reply},
+	}, true, false)
+	if err == nil {
+		_, err = tr.w.Write(append(line, '\n'))
+	}
+	tr.err = err
+}
+
+// exchange is a recorded command and its reply.
+type exchange struct {
+	db      string
+	command bson.D
+	reply   bson.D
+}
+
+// replayer answers commands with the recorded replies. A command is matched
+// with the earliest unused exchange that has the same database, command name
+// and target (the collection name or cursor id), so that
+// concurrent operations replay correctly as long as each one is issued the
+// same way it was recorded.
+type replayer struct {
+	mu        sync.Mutex
+	exchanges []*exchange
+}
+
+func readTraffic(r io.Reader) ([]*exchange, error) {
+	var out []*exchange
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, maxMessageSize)
+	for n := 1; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var line struct {
+			DB      string `bson:"db"`
+			Command bson.D `bson:"command"`
+			Reply   bson.D `bson:"reply"`
+		}
+		if err := bson.UnmarshalExtJSON(sc.Bytes(), true, &line); err != nil {
+			return nil, fmt.Errorf("mongowrappertest: traffic line %d: %v", n, err)
+		}
+		if len(line.Command) == 0 {
+			return nil, fmt.Errorf("mongowrappertest: traffic line %d: missing command", n)
+		}
+		out = append(out, &exchange{db: line.DB, command: line.Command, reply: line.Reply})
+	}
+	return out, sc.Err()
+}
+
+// next removes and returns the reply recorded for cmd.
+func (rp *replayer) next(db string, cmd bson.D) (bson.D, bool) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	for i, ex := range rp.exchanges {
+		if ex.db == db && ex.command[0].Key == cmd[0].Key && sameTarget(ex.command[0].Value, cmd[0].Value) {
+			rp.exchanges = append(rp.exchanges[:i:i], rp.exchanges[i+1:]...)
+			return ex.reply, true
+		}
+	}
+	return nil, false
+}
+
+// sameTarget reports whether two command values name the same collection or
+// cursor. Other values, such as the session ids of endSessions, differ from
+// run to run and are not compared.
+func sameTarget(recorded, got interface{}) bool {
+	switch recorded.(type) {
+	case string, int32, int64:
+		return equal(recorded, got)
+	}
+	return true
+}
+
+func (rp *replayer) pending() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	return len(rp.exchanges)
+}
+
+// NewReplayServer starts a Server that answers commands with the replies
+// read from r, as written by a TrafficRecorder. Connection handshakes are
+// answered as usual; any other command without a recorded reply fails with
+// an error naming it.
+func NewReplayServer(r io.Reader) (*Server, error) {
+	exchanges, err := readTraffic(r)
+	if err != nil {
+		return nil, err
+	}
+	s, err := listen()
+	if err != nil {
+		return nil, err
+	}
+
+	s.replay = &replayer{exchanges: exchanges}
+	s.handle = func(db string, cmd bson.D) bson.D {
+		if len(cmd) > 0 {
+			if reply, ok := s.replay.next(db, cmd); ok {
+				return reply
+			}
+			if isHandshake(cmd[0].Key) || cmd[0].Key == "endSessions" {
+				return s.runCommand(db, cmd)
+			}
+		}
+		return commandError(8000, "", fmt.Sprintf("mongowrappertest: no recorded reply for %v", cmd))
+	}
+	s.start()
+	return s, nil
+}
+
+// PendingReplies returns how many recorded replies a replay server has not
+// served yet; it is zero for other servers.
+func (s *Server) PendingReplies() int {
+	if s.replay == nil {
+		return 0
+	}
+	return s.replay.pending()
+}
+
+func isHandshake(name string) bool {
+	switch name {
+	case "isMaster", "ismaster", "hello":
+		return true
+	}
+	return false
+}
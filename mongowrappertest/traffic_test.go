@@ -0,0 +1,173 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+)
+
+func TestTrafficRecordAndReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// run performs the same operations against whatever server uri points to.
+	run := func(uri string, monitored *TrafficRecorder) []string {
+		opts := options.Client().ApplyURI(uri)
+		if monitored != nil {
+			opts.SetMonitor(monitored.Monitor())
+		}
+		client, err := mongowrapper.NewClient(opts)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		defer client.Disconnect(ctx)
+
+		coll := client.Database("the_db").Collection("music")
+		if _, err := coll.InsertMany(ctx, []interface{}{
+			bson.M{"_id": 1, "name": "a"}, bson.M{"_id": 2, "name": "b"}, bson.M{"_id": 3, "name": "c"},
+		}); err != nil {
+			t.Fatalf("InsertMany: %v", err)
+		}
+		if _, err := coll.InsertOne(ctx, bson.M{"_id": 1}); err == nil {
+			t.Fatal("InsertOne: expected a duplicate key error")
+		} else if we, ok := err.(mongo.WriteException); !ok || we.WriteErrors[0].Code != 11000 {
+			t.Fatalf("InsertOne: got %v, want a duplicate key error", err)
+		}
+
+		cur, err := coll.Find(ctx, bson.M{}, options.Find().SetBatchSize(2))
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		var docs []struct{ Name string }
+		if err := cur.All(ctx, &docs); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+		var names []string
+		for _, d := range docs {
+			names = append(names, d.Name)
+		}
+		return names
+	}
+
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	var log bytes.Buffer
+	tr := NewTrafficRecorder(&log)
+	recorded := run(srv.URI(), tr)
+	srv.Close()
+	if err := tr.Err(); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+
+	replay, err := NewReplayServer(bytes.NewReader(log.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReplayServer: %v", err)
+	}
+	defer replay.Close()
+	replayed := run(replay.URI(), nil)
+
+	if len(recorded) != 3 || len(replayed) != len(recorded) {
+		t.Fatalf("got %v on replay, want %v", replayed, recorded)
+	}
+	for i := range recorded {
+		if recorded[i] != replayed[i] {
+			t.Fatalf("got %v on replay, want %v", replayed, recorded)
+		}
+	}
+	if n := replay.PendingReplies(); n != 0 {
+		t.Errorf("PendingReplies: got %d, want 0", n)
+	}
+}
+
+func TestTrafficRecordsCommandErrors(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	failure := bson.D{
+		{Key: "ok", Value: 0.0},
+		{Key: "errmsg", Value: "operation exceeded time limit"},
+		{Key: "code", Value: int32(50)},
+		{Key: "codeName", Value: "MaxTimeMSExpired"},
+		{Key: "errorLabels", Value: bson.A{"SomeLabel"}},
+	}
+	run := func(uri string, tr *TrafficRecorder) mongo.CommandError {
+		opts := options.Client().ApplyURI(uri)
+		if tr != nil {
+			opts.SetMonitor(tr.Monitor())
+		}
+		client, err := mongowrapper.NewClient(opts)
+		if err != nil {
+			t.Fatalf("NewClient: %v", err)
+		}
+		if tr != nil {
+			client.AddInterceptors(tr.Interceptor())
+		}
+		if err := client.Connect(ctx); err != nil {
+			t.Fatalf("Connect: %v", err)
+		}
+		defer client.Disconnect(ctx)
+
+		_, err = client.Database("the_db").Collection("music").Distinct(ctx, "name", bson.M{})
+		ce, ok := err.(mongo.CommandError)
+		if !ok {
+			t.Fatalf("Distinct: got %v, want a command error", err)
+		}
+		return ce
+	}
+
+	srv, err := NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	srv.handle = func(db string, cmd bson.D) bson.D {
+		if len(cmd) > 0 && cmd[0].Key == "distinct" {
+			return failure
+		}
+		return srv.runCommand(db, cmd)
+	}
+	var log bytes.Buffer
+	tr := NewTrafficRecorder(&log)
+	recorded := run(srv.URI(), tr)
+	srv.Close()
+	if err := tr.Err(); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+
+	replay, err := NewReplayServer(bytes.NewReader(log.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReplayServer: %v", err)
+	}
+	defer replay.Close()
+	replayed := run(replay.URI(), nil)
+
+	if replayed.Code != 50 || replayed.Name != "MaxTimeMSExpired" || !replayed.HasErrorLabel("SomeLabel") ||
+		replayed.Error() != recorded.Error() {
+		t.Errorf("got %+v on replay, want %+v", replayed, recorded)
+	}
+}
@@ -0,0 +1,179 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func isUpdateDoc(update bson.D) bool { return isOperatorDoc(update) }
+
+// applyUpdate returns a copy of doc modified by the update operators in
+// update. The supported operators are $set, $unset, $inc and $push, the
+// latter with $each.
+func applyUpdate(doc, update bson.D) (bson.D, error) {
+	out := copyDoc(doc)
+	for _, op := range update {
+		fields, ok := op.Value.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("mongowrappertest: %s needs a document", op.Key)
+		}
+		for _, f := range fields {
+			parts := splitPath(f.Key)
+			if parts[0] == "_id" {
+				if cur, _ := lookupKey(out, "_id"); op.Key != "$set" || !equal(cur, f.Value) {
+					return nil, fmt.Errorf("mongowrappertest: the _id field cannot be modified")
+				}
+			}
+
+			var err error
+			switch op.Key {
+			case "$set":
+				out, err = setPath(out, parts, copyValue(f.Value))
+			case "$unset":
+				out = unsetPath(out, parts)
+			case "$inc":
+				out, err = inc(out, f.Key, f.Value)
+			case "$push":
+				out, err = push(out, f.Key, f.Value)
+			default:
+				err = fmt.Errorf("mongowrappertest: unsupported update operator %s", op.Key)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return out, nil
+}
+
+func inc(doc bson.D, path string, by interface{}) (bson.D, error) {
+	if _, ok := toFloat(by); !ok {
+		return nil, fmt.Errorf("mongowrappertest: $inc needs a number for %s", path)
+	}
+	cur, ok := firstValue(doc, path)
+	if !ok {
+		return setPath(doc, splitPath(path), by)
+	}
+	sum, err := add(cur, by)
+	if err != nil {
+		return nil, fmt.Errorf("mongowrappertest: cannot $inc %s: %v", path, err)
+	}
+	return setPath(doc, splitPath(path), sum)
+}
+
+// add adds two numbers, widening the result type like the server does.
+func add(a, b interface{}) (interface{}, error) {
+	switch av := a.(type) {
+	case int32:
+		switch bv := b.(type) {
+		case int32:
+			return av + bv, nil
+		case int64:
+			return int64(av) + bv, nil
+		}
+	case int64:
+		switch bv := b.(type) {
+		case int32:
+			return av + int64(bv), nil
+		case int64:
+			return av + bv, nil
+		}
+	}
+	fa, ok := toFloat(a)
+	if !ok {
+		return nil, fmt.Errorf("%T is not a number", a)
+	}
+	fb, _ := toFloat(b)
+	return fa + fb, nil
+}
+
+func push(doc bson.D, path string, v interface{}) (bson.D, error) {
+	values := bson.A{copyValue(v)}
+	if d, ok := v.(bson.D); ok && len(d) > 0 && d[0].Key == "$each" {
+		each, ok := d[0].Value.(bson.A)
+		if !ok {
+			return nil, fmt.Errorf("mongowrappertest: $each needs an array")
+		}
+		values = copyValue(each).(bson.A)
+	}
+
+	cur, ok := firstValue(doc, path)
+	if !ok {
+		return setPath(doc, splitPath(path), values)
+	}
+	arr, ok := cur.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("mongowrappertest: cannot $push to non-array field %s", path)
+	}
+	return setPath(doc, splitPath(path), append(append(bson.A{}, arr...), values...))
+}
+
+// replaceDoc returns replacement with the _id of doc.
+func replaceDoc(doc, replacement bson.D) (bson.D, error) {
+	if isUpdateDoc(replacement) {
+		return nil, fmt.Errorf("mongowrappertest: replacement document cannot contain update operators")
+	}
+	id, _ := lookupKey(doc, "_id")
+	out := bson.D{{Key: "_id", Value: id}}
+	for _, e := range replacement {
+		if e.Key == "_id" {
+			if !equal(e.Value, id) {
+				return nil, fmt.Errorf("mongowrappertest: the _id field cannot be modified")
+			}
+			continue
+		}
+		out = append(out, bson.E{Key: e.Key, Value: copyValue(e.Value)})
+	}
+	return out, nil
+}
+
+// upsertSeed returns the document an upsert starts from: the equality
+// conditions of filter, including those of its $and clauses.
+func upsertSeed(filter bson.D) bson.D {
+	return addUpsertSeed(bson.D{}, filter)
+}
+
+func addUpsertSeed(seed, filter bson.D) bson.D {
+	for _, e := range filter {
+		if e.Key == "$and" {
+			clauses, _ := e.Value.(bson.A)
+			for _, c := range clauses {
+				if d, ok := c.(bson.D); ok {
+					seed = addUpsertSeed(seed, d)
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(e.Key, "$") {
+			continue
+		}
+		v := e.Value
+		if cond, ok := v.(bson.D); ok && isOperatorDoc(cond) {
+			eq, ok := lookupKey(cond, "$eq")
+			if !ok {
+				continue
+			}
+			v = eq
+		}
+		if d, err := setPath(seed, splitPath(e.Key), copyValue(v)); err == nil {
+			seed = d
+		}
+	}
+	return seed
+}
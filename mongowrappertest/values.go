@@ -0,0 +1,354 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrappertest
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// toDoc converts a document given in any form the driver accepts into a
+// bson.D whose nested documents and arrays are bson.D and bson.A.
+func toDoc(v interface{}) (bson.D, error) {
+	if v == nil {
+		return bson.D{}, nil
+	}
+	raw, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// toDocs converts a pipeline or other list of documents.
+func toDocs(v interface{}) ([]bson.D, error) {
+	if v == nil {
+		return nil, nil
+	}
+	// Wrap the list in a document so that the driver can marshal it.
+	d, err := toDoc(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := d[0].Value.(bson.A)
+	if !ok {
+		return nil, fmt.Errorf("mongowrappertest: expected an array, got %T", d[0].Value)
+	}
+	docs := make([]bson.D, 0, len(arr))
+	for _, e := range arr {
+		ed, ok := e.(bson.D)
+		if !ok {
+			return nil, fmt.Errorf("mongowrappertest: expected a document, got %T", e)
+		}
+		docs = append(docs, ed)
+	}
+	return docs, nil
+}
+
+// toValue normalizes a single value the way toDoc normalizes documents.
+func toValue(v interface{}) (interface{}, error) {
+	d, err := toDoc(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return nil, err
+	}
+	return d[0].Value, nil
+}
+
+func copyDoc(d bson.D) bson.D {
+	out := make(bson.D, len(d))
+	for i, e := range d {
+		out[i] = bson.E{Key: e.Key, Value: copyValue(e.Value)}
+	}
+	return out
+}
+
+func copyValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		return copyDoc(v)
+	case bson.A:
+		out := make(bson.A, len(v))
+		for i, e := range v {
+			out[i] = copyValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+func lookupKey(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lookupPath resolves a dotted path against v. Arrays met along the way are
+// traversed, so the result can hold several values; it is empty if the path
+// does not exist.
+func lookupPath(v interface{}, parts []string) []interface{} {
+	if len(parts) == 0 {
+		return []interface{}{v}
+	}
+	switch v := v.(type) {
+	case bson.D:
+		child, ok := lookupKey(v, parts[0])
+		if !ok {
+			return nil
+		}
+		return lookupPath(child, parts[1:])
+	case bson.A:
+		if i, err := strconv.Atoi(parts[0]); err == nil {
+			if i < 0 || i >= len(v) {
+				return nil
+			}
+			return lookupPath(v[i], parts[1:])
+		}
+		var out []interface{}
+		for _, e := range v {
+			if _, ok := e.(bson.D); ok {
+				out = append(out, lookupPath(e, parts)...)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func splitPath(path string) []string { return strings.Split(path, ".") }
+
+// firstValue returns the first value at path, or nil.
+func firstValue(d bson.D, path string) (interface{}, bool) {
+	vs := lookupPath(d, splitPath(path))
+	if len(vs) == 0 {
+		return nil, false
+	}
+	return vs[0], true
+}
+
+// setPath returns d with the value at the dotted path set to v, creating the
+// intermediate documents as needed.
+func setPath(d bson.D, parts []string, v interface{}) (bson.D, error) {
+	key := parts[0]
+	for i, e := range d {
+		if e.Key != key {
+			continue
+		}
+		if len(parts) == 1 {
+			d[i].Value = v
+			return d, nil
+		}
+		child, err := setChild(e.Value, parts[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		d[i].Value = child
+		return d, nil
+	}
+	if len(parts) == 1 {
+		return append(d, bson.E{Key: key, Value: v}), nil
+	}
+	child, err := setPath(bson.D{}, parts[1:], v)
+	if err != nil {
+		return nil, err
+	}
+	return append(d, bson.E{Key: key, Value: child}), nil
+}
+
+func setChild(cur interface{}, parts []string, v interface{}) (interface{}, error) {
+	switch cur := cur.(type) {
+	case bson.D:
+		return setPath(cur, parts, v)
+	case bson.A:
+		i, err := strconv.Atoi(parts[0])
+		if err != nil || i < 0 {
+			return nil, fmt.Errorf("mongowrappertest: cannot index array with %q", parts[0])
+		}
+		for len(cur) <= i {
+			cur = append(cur, nil)
+		}
+		if len(parts) == 1 {
+			cur[i] = v
+			return cur, nil
+		}
+		child, err := setChild(cur[i], parts[1:], v)
+		if err != nil {
+			return nil, err
+		}
+		cur[i] = child
+		return cur, nil
+	case nil:
+		return setPath(bson.D{}, parts, v)
+	}
+	return nil, fmt.Errorf("mongowrappertest: cannot create field %q in a %T", parts[0], cur)
+}
+
+// unsetPath returns d without the value at the dotted path.
+func unsetPath(d bson.D, parts []string) bson.D {
+	for i, e := range d {
+		if e.Key != parts[0] {
+			continue
+		}
+		if len(parts) == 1 {
+			return append(d[:i:i], d[i+1:]...)
+		}
+		if child, ok := e.Value.(bson.D); ok {
+			d[i].Value = unsetPath(child, parts[1:])
+		}
+		return d
+	}
+	return d
+}
+
+// typeRank orders values of different types the way MongoDB sorts them.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 1
+	case int32, int64, float64, primitive.Decimal128:
+		return 2
+	case string, primitive.Symbol:
+		return 3
+	case bson.D:
+		return 4
+	case bson.A:
+		return 5
+	case primitive.Binary:
+		return 6
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime, time.Time:
+		return 9
+	case primitive.Timestamp:
+		return 10
+	case primitive.Regex:
+		return 11
+	}
+	return 12
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// compare orders a and b, reporting whether they are of the same type
+// bracket, which is required for $gt and friends to match.
+func compare(a, b interface{}) (int, bool) {
+	ra, rb := typeRank(a), typeRank(b)
+	if ra != rb {
+		if ra < rb {
+			return -1, false
+		}
+		return 1, false
+	}
+
+	switch av := a.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return 0, true
+	case int32, int64, float64:
+		fa, _ := toFloat(av)
+		fb, _ := toFloat(b)
+		return cmpFloat(fa, fb), true
+	case string:
+		return strings.Compare(av, b.(string)), true
+	case bool:
+		bv := b.(bool)
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		}
+		return 1, true
+	case primitive.ObjectID:
+		bv := b.(primitive.ObjectID)
+		return bytes.Compare(av[:], bv[:]), true
+	case primitive.DateTime:
+		bv, ok := b.(primitive.DateTime)
+		if !ok {
+			return 0, false
+		}
+		return cmpFloat(float64(av), float64(bv)), true
+	case primitive.Timestamp:
+		bv := b.(primitive.Timestamp)
+		if av.T != bv.T {
+			return cmpFloat(float64(av.T), float64(bv.T)), true
+		}
+		return cmpFloat(float64(av.I), float64(bv.I)), true
+	case bson.D:
+		bv := b.(bson.D)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c := strings.Compare(av[i].Key, bv[i].Key); c != 0 {
+				return c, true
+			}
+			if c, _ := compare(av[i].Value, bv[i].Value); c != 0 {
+				return c, true
+			}
+		}
+		return cmpFloat(float64(len(av)), float64(len(bv))), true
+	case bson.A:
+		bv := b.(bson.A)
+		for i := 0; i < len(av) && i < len(bv); i++ {
+			if c, _ := compare(av[i], bv[i]); c != 0 {
+				return c, true
+			}
+		}
+		return cmpFloat(float64(len(av)), float64(len(bv))), true
+	}
+	// Fall back to comparing the representations of the remaining types.
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)), true
+}
+
+func cmpFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	case math.IsNaN(a) && !math.IsNaN(b):
+		return -1
+	}
+	return 0
+}
+
+func equal(a, b interface{}) bool {
+	c, ok := compare(a, b)
+	return ok && c == 0
+}
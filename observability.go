@@ -29,9 +29,44 @@ var (
 	keyMethod, _ = tag.NewKey("method")
 	keyStatus, _ = tag.NewKey("status")
 	keyError, _  = tag.NewKey("error")
+
+	keyTxnOutcome, _     = tag.NewKey("txn_outcome")
+	keyTxnRetryReason, _ = tag.NewKey("txn_retry_reason")
+
+	keyNamespace, _ = tag.NewKey("namespace")
+	keyGuardRule, _ = tag.NewKey("write_guard_rule")
+
+	keyAttribution, _ = tag.NewKey("attribution")
+
+	// keyOperationTime carries a session's operation time across services;
+	// it is not part of any view.
+	keyOperationTime, _ = tag.NewKey("mongo_operation_time")
 )
 
-var mLatencyMs = stats.Float64("latency", "The latency in milliseconds", "ms")
+var (
+	mLatencyMs = stats.Float64("latency", "The latency in milliseconds", "ms")
+
+	mTxnAttempts  = stats.Int64("transaction_attempts", "The number of transaction attempts", "1")
+	mTxnLatencyMs = stats.Float64("transaction_latency", "The latency of transactions in milliseconds", "ms")
+
+	mLiveSessions       = stats.Int64("live_sessions", "The number of sessions started but not yet ended", "1")
+	mSessionsInProgress = stats.Int64("sessions_in_progress", "The number of sessions in progress as reported by the driver", "1")
+
+	mGridFSBytes  = stats.Int64("gridfs_bytes", "The number of bytes uploaded to or downloaded from GridFS", "By")
+	mGridFSChunks = stats.Int64("gridfs_chunks", "The number of GridFS chunks uploaded or downloaded", "1")
+
+	mOpenCursors   = stats.Int64("open_cursors", "The number of cursors neither closed nor exhausted", "1")
+	mLeakedCursors = stats.Int64("leaked_cursors", "The number of cursors garbage collected without being closed", "1")
+
+	mGuardRejections = stats.Int64("write_guard_rejections", "The number of writes rejected by the write guard", "1")
+
+	mDocsReturned  = stats.Int64("documents_returned", "The number of documents returned to the application", "1")
+	mDocsMatched   = stats.Int64("documents_matched", "The number of documents matched on the server", "1")
+	mBytesSent     = stats.Int64("bytes_sent", "The size of the filters, updates, documents and pipelines sent", "By")
+	mBytesReturned = stats.Int64("bytes_returned", "The size of the documents returned to the application", "By")
+
+	mSlowOps = stats.Int64("slow_operations", "The number of operations slower than their threshold", "1")
+)
 
 var latencyDistribution = view.Distribution(
 	// [0ms, 0.001ms, 0.005ms, 0.01ms, 0.05ms, 0.1ms, 0.5ms, 1ms, 1.5ms, 2ms, 2.5ms, 5ms, 10ms, 25ms, 50ms, 100ms, 200ms,
@@ -53,6 +88,105 @@ var allViews = []*view.View{
 		Aggregation: view.Count(),
 		TagKeys:     []tag.Key{keyMethod, keyStatus, keyError},
 	},
+	{
+		Name: "mongo/client/transaction/attempts", Description: "The number of transaction attempts made by WithTransaction",
+		Measure:     mTxnAttempts,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyTxnRetryReason},
+	},
+	{
+		Name: "mongo/client/transaction/latency", Description: "The latency of transactions from start to commit or abort",
+		Measure:     mTxnLatencyMs,
+		Aggregation: latencyDistribution,
+		TagKeys:     []tag.Key{keyTxnOutcome},
+	},
+	{
+		Name: "mongo/client/transactions", Description: "The number of committed and aborted transactions",
+		Measure:     mTxnLatencyMs,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyTxnOutcome},
+	},
+	{
+		Name: "mongo/client/sessions/live", Description: "The number of sessions tracked by a SessionTracker that have not been ended",
+		Measure:     mLiveSessions,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name: "mongo/client/sessions/in_progress", Description: "The number of sessions in progress on the client",
+		Measure:     mSessionsInProgress,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name: "mongo/client/gridfs/bytes", Description: "The number of bytes transferred by GridFS operations",
+		Measure:     mGridFSBytes,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyMethod},
+	},
+	{
+		Name: "mongo/client/gridfs/chunks", Description: "The number of chunks transferred by GridFS operations",
+		Measure:     mGridFSChunks,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyMethod},
+	},
+	{
+		Name: "mongo/client/cursors/open", Description: "The number of cursors tracked by a CursorTracker that are neither closed nor exhausted",
+		Measure:     mOpenCursors,
+		Aggregation: view.LastValue(),
+	},
+	{
+		Name: "mongo/client/cursors/leaked", Description: "The number of cursors garbage collected without being closed",
+		Measure:     mLeakedCursors,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyNamespace},
+	},
+	{
+		Name: "mongo/client/write_guard/rejections", Description: "The number of DeleteMany, UpdateMany and Drop calls rejected by the write guard",
+		Measure:     mGuardRejections,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyMethod, keyNamespace, keyGuardRule},
+	},
+	{
+		Name: "mongo/client/slow_operations", Description: "The number of calls slower than the threshold of a SlowOpDetector",
+		Measure:     mSlowOps,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyMethod, keyNamespace},
+	},
+	{
+		Name: "mongo/client/cost/calls", Description: "The various calls per attribution key",
+		Measure:     mLatencyMs,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{keyAttribution, keyMethod},
+	},
+	{
+		Name: "mongo/client/cost/latency", Description: "The total latency of the various calls per attribution key",
+		Measure:     mLatencyMs,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyAttribution, keyMethod},
+	},
+	{
+		Name: "mongo/client/cost/documents_returned", Description: "The number of documents returned per attribution key",
+		Measure:     mDocsReturned,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyAttribution, keyMethod, keyNamespace},
+	},
+	{
+		Name: "mongo/client/cost/documents_matched", Description: "The number of documents matched on the server per attribution key",
+		Measure:     mDocsMatched,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyAttribution, keyMethod, keyNamespace},
+	},
+	{
+		Name: "mongo/client/cost/bytes_sent", Description: "The number of bytes of arguments sent per attribution key",
+		Measure:     mBytesSent,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyAttribution, keyMethod, keyNamespace},
+	},
+	{
+		Name: "mongo/client/cost/bytes_returned", Description: "The number of bytes of documents returned per attribution key",
+		Measure:     mBytesReturned,
+		Aggregation: view.Sum(),
+		TagKeys:     []tag.Key{keyAttribution, keyMethod, keyNamespace},
+	},
 }
 
 func RegisterAllViews() error {
@@ -72,10 +206,23 @@ type spanWithMetrics struct {
 }
 
 func roundtripTrackingSpan(ctx context.Context, methodName string, traceOpts ...trace.StartOption) (context.Context, *spanWithMetrics) {
-	ctx, span := trace.StartSpan(ctx, methodName, traceOpts...)
+	ctx, span := startSpan(ctx, methodName, traceOpts...)
 	return ctx, &spanWithMetrics{span: span, startTime: time.Now(), method: methodName}
 }
 
+func startSpan(ctx context.Context, methodName string, traceOpts ...trace.StartOption) (context.Context, *trace.Span) {
+	ws := sessionFromContext(ctx)
+	if ws != nil {
+		// Operations run in a session's transaction are parented on it.
+		ctx = ws.TransactionContext(ctx)
+	}
+	ctx, span := trace.StartSpan(ctx, methodName, traceOpts...)
+	if ws != nil {
+		span.AddAttributes(trace.StringAttribute("mongo.session_id", ws.ID()))
+	}
+	return ctx, span
+}
+
 func (swm *spanWithMetrics) setError(err error) {
 	if err != nil {
 		swm.span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
@@ -85,14 +232,20 @@ func (swm *spanWithMetrics) setError(err error) {
 
 func (swm *spanWithMetrics) end(ctx context.Context) {
 	swm.endOnce.Do(func() {
-		if err := swm.lastErr; err == nil {
-			ctx, _ = tag.New(ctx, tag.Upsert(keyMethod, swm.method), tag.Upsert(keyStatus, "OK"))
-		} else {
-			ctx, _ = tag.New(ctx, tag.Upsert(keyMethod, swm.method), tag.Upsert(keyError, err.Error()))
-		}
-
-		latencyMs := float64(time.Now().Sub(swm.startTime)) / 1e6
-		stats.Record(ctx, mLatencyMs.M(latencyMs))
+		recordLatency(ctx, swm.method, swm.startTime, swm.lastErr)
 		swm.span.End()
 	})
 }
+
+func recordLatency(ctx context.Context, method string, startTime time.Time, err error) {
+	mutators := []tag.Mutator{tag.Upsert(keyMethod, method)}
+	if err == nil {
+		mutators = append(mutators, tag.Upsert(keyStatus, "OK"))
+	} else {
+		mutators = append(mutators, tag.Upsert(keyError, err.Error()))
+	}
+	ctx, _ = tag.New(withAttribution(ctx), mutators...)
+
+	latencyMs := float64(time.Now().Sub(startTime)) / 1e6
+	stats.Record(ctx, mLatencyMs.M(latencyMs))
+}
@@ -83,8 +83,10 @@ func TestUnitRoundtripTrackingOperation(t *testing.T) {
 			done = true
 			break
 		case vd := <-viewDataChan:
-			// Great!
-			vds = append(vds, vd)
+			// Only the method views are of interest here.
+			if name := vd.View.Name; name == "mongo/client/latency" || name == "mongo/client/calls" {
+				vds = append(vds, vd)
+			}
 		}
 	}
 
@@ -180,3 +182,19 @@ func (me *mockExporter) ExportView(vd *view.Data) {
 func (me *mockExporter) ExportSpan(sd *trace.SpanData) {
 	me.spanDataChan <- sd
 }
+
+func TestUnitUninstrumentedSkipsOnlyBuiltins(t *testing.T) {
+	var seen []bool
+	cfg := &config{interceptors: []Interceptor{func(ctx context.Context, op *Operation, invoke Invoker) error {
+		seen = append(seen, trace.FromContext(ctx) != nil)
+		return invoke(ctx, op)
+	}}}
+	op := &Operation{Method: methodPrefix + "Collection.InsertMany"}
+	invoke := func(context.Context, *Operation) error { return nil }
+
+	cfg.intercept(context.Background(), op, invoke)
+	cfg.intercept(uninstrumented(context.Background()), op, invoke)
+	if !reflect.DeepEqual(seen, []bool{true, false}) {
+		t.Errorf("interceptor calls in a span: got %v, want [true false]", seen)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// QueryStats are the statistics of the operations sharing a fingerprint:
+// the same method, namespace and filter or pipeline shape.
+type QueryStats struct {
+	Fingerprint string
+	Method      string
+	Namespace   string
+	// Shape is the filter, or the pipeline, with its values redacted.
+	Shape string
+
+	Calls        int64
+	Errors       int64
+	TotalLatency time.Duration
+	MinLatency   time.Duration
+	MaxLatency   time.Duration
+	// DocsReturned counts the documents handed out by the cursors, single
+	// results and Distinct calls of the operations. Only the cursors of the
+	// *Wrapped methods, such as FindWrapped, are counted: those returned by
+	// Find and Aggregate are driver cursors the wrapper does not see
+	// iterated.
+	DocsReturned int64
+
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// MeanLatency returns the average latency of the calls.
+func (qs QueryStats) MeanLatency() time.Duration {
+	if qs.Calls == 0 {
+		return 0
+	}
+	return qs.TotalLatency / time.Duration(qs.Calls)
+}
+
+// QueryStatsRegistry keeps QueryStats for every fingerprint seen, in the
+// manner of pg_stat_statements. It is safe for concurrent use.
+type QueryStatsRegistry struct {
+	maxShapes int
+
+	mu    sync.Mutex
+	stats map[string]*queryStatsEntry
+	// windowed is set once a flusher reads the windows; the windows of
+	// evicted fingerprints are then kept in evicted until the next flush.
+	windowed bool
+	evicted  []QueryStats
+}
+
+type queryStatsEntry struct {
+	QueryStats
+	// window holds what happened since the last flushWindow.
+	window QueryStats
+}
+
+// NewQueryStatsRegistry returns a registry keeping at most maxShapes
+// fingerprints, or any number if maxShapes is 0. When full, the least called
+// fingerprint is evicted to make room for a new one.
+func NewQueryStatsRegistry(maxShapes int) *QueryStatsRegistry {
+	return &QueryStatsRegistry{maxShapes: maxShapes, stats: make(map[string]*queryStatsEntry)}
+}
+
+// SetQueryStatsRegistry makes every operation of the client feed r. It must
+// be called before the client is used.
+func (wc *WrappedClient) SetQueryStatsRegistry(r *QueryStatsRegistry) {
+	wc.AddInterceptors(r.Interceptor())
+}
+
+// Interceptor returns the Interceptor feeding r, for use with NewCollection.
+// The Next and TryNext calls of change streams, which wait for a change to
+// happen, are left out.
+func (r *QueryStatsRegistry) Interceptor() Interceptor {
+	return func(ctx context.Context, op *Operation, invoke Invoker) error {
+		if isUninstrumented(ctx) || isChangeStreamWait(op) {
+			return invoke(ctx, op)
+		}
+		// Fingerprint the operation as issued, not as restricted to a
+		// tenant.
+		shape := operationShape(issuedOperation(ctx, op))
+		start := time.Now()
+		err := invoke(ctx, op)
+		latency := time.Since(start)
+
+		fp := fingerprint(op.Method, op.Namespace(), shape)
+		r.record(fp, op, shape, latency, err)
+
+		switch res := op.Result.(type) {
+		case *WrappedCursor:
+			if res != nil {
+				res.observeReturned(func(n, _ int64) { r.addReturned(fp, n) })
+			}
+		case *WrappedSingleResult:
+			if res.Err() == nil {
+				r.addReturned(fp, 1)
+			}
+		case []interface{}:
+			r.addReturned(fp, int64(len(res)))
+		}
+		return err
+	}
+}
+
+func fingerprint(method, namespace, shape string) string {
+	h := sha1.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(namespace))
+	h.Write([]byte{0})
+	h.Write([]byte(shape))
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func (r *QueryStatsRegistry) record(fp string, op *Operation, shape string, latency time.Duration, err error) {
+	now := time.Now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.stats[fp]
+	if !ok {
+		if r.maxShapes > 0 && len(r.stats) >= r.maxShapes {
+			r.evictLocked()
+		}
+		e = &queryStatsEntry{QueryStats: QueryStats{
+			Fingerprint: fp, Method: op.Method, Namespace: op.Namespace(), Shape: shape, FirstSeen: now,
+		}}
+		e.window = e.QueryStats
+		r.stats[fp] = e
+	}
+	failed := err != nil && err != mongo.ErrNoDocuments
+	e.QueryStats.add(latency, failed, now)
+	e.window.add(latency, failed, now)
+}
+
+func (qs *QueryStats) add(latency time.Duration, failed bool, now time.Time) {
+	if qs.Calls == 0 || latency < qs.MinLatency {
+		qs.MinLatency = latency
+	}
+	if latency > qs.MaxLatency {
+		qs.MaxLatency = latency
+	}
+	qs.Calls++
+	if failed {
+		qs.Errors++
+	}
+	qs.TotalLatency += latency
+	qs.LastSeen = now
+}
+
+// evictLocked drops the least called fingerprint, preferring those idle
+// since the last flush, and keeps its pending window for the next one. r.mu
+// must be held.
+func (r *QueryStatsRegistry) evictLocked() {
+	var victim *queryStatsEntry
+	for _, e := range r.stats {
+		if victim == nil || evictBefore(e, victim) {
+			victim = e
+		}
+	}
+	if victim == nil {
+		return
+	}
+	delete(r.stats, victim.Fingerprint)
+	if r.windowed && victim.window.pending() {
+		r.evicted = append(r.evicted, victim.window)
+	}
+}
+
+func evictBefore(a, b *queryStatsEntry) bool {
+	if a.window.pending() != b.window.pending() {
+		return !a.window.pending()
+	}
+	if a.Calls != b.Calls {
+		return a.Calls < b.Calls
+	}
+	return a.LastSeen.Before(b.LastSeen)
+}
+
+func (qs *QueryStats) pending() bool {
+	return qs.Calls != 0 || qs.DocsReturned != 0
+}
+
+// keepWindows makes evictions keep the windows not flushed yet.
+func (r *QueryStatsRegistry) keepWindows() {
+	r.mu.Lock()
+	r.windowed = true
+	r.mu.Unlock()
+}
+
+func (r *QueryStatsRegistry) addReturned(fp string, n int64) {
+	r.mu.Lock()
+	if e, ok := r.stats[fp]; ok {
+		e.DocsReturned += n
+		e.window.DocsReturned += n
+	}
+	r.mu.Unlock()
+}
+
+// Snapshot returns a copy of the statistics of every fingerprint, in no
+// particular order.
+func (r *QueryStatsRegistry) Snapshot() []QueryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := make([]QueryStats, 0, len(r.stats))
+	for _, e := range r.stats {
+		out = append(out, e.QueryStats)
+	}
+	return out
+}
+
+// flushWindow returns, for every fingerprint active since the previous
+// call, the statistics of that period only, and starts a new period.
+func (r *QueryStatsRegistry) flushWindow() []QueryStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	out := r.evicted
+	r.evicted = nil
+	for _, e := range r.stats {
+		if !e.window.pending() {
+			continue
+		}
+		out = append(out, e.window)
+		e.window = QueryStats{
+			Fingerprint: e.Fingerprint, Method: e.Method, Namespace: e.Namespace, Shape: e.Shape,
+			FirstSeen: time.Now(),
+		}
+	}
+	return out
+}
+
+// Top returns the statistics of the n fingerprints with the highest total
+// latency, highest first.
+func (r *QueryStatsRegistry) Top(n int) []QueryStats {
+	all := r.Snapshot()
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].TotalLatency != all[j].TotalLatency {
+			return all[i].TotalLatency > all[j].TotalLatency
+		}
+		return all[i].Fingerprint < all[j].Fingerprint
+	})
+	if n >= 0 && n < len(all) {
+		all = all[:n]
+	}
+	return all
+}
+
+// Reset forgets every fingerprint.
+func (r *QueryStatsRegistry) Reset() {
+	r.mu.Lock()
+	r.stats = make(map[string]*queryStatsEntry)
+	r.evicted = nil
+	r.mu.Unlock()
+}
@@ -0,0 +1,144 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// QueryStatsFlusher periodically writes the statistics gathered by a
+// QueryStatsRegistry into a collection, one document per fingerprint active
+// during the period:
+//
+//	{fingerprint, method, namespace, shape, host, window_start, window_end,
+//	 calls, errors, total_latency_ms, min_latency_ms, max_latency_ms,
+//	 docs_returned}
+//
+// The counts and latencies cover the period only, so documents can be
+// summed across periods and deploys. The writes skip the interceptors added
+// to the client, such as tenancy or the registry's own, and are not traced
+// or measured.
+type QueryStatsFlusher struct {
+	// Logger receives flush errors; nil means the standard logger.
+	Logger *log.Logger
+
+	reg      *QueryStatsRegistry
+	coll     *WrappedCollection
+	interval time.Duration
+	host     string
+
+	mu        sync.Mutex
+	lastFlush time.Time
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewQueryStatsFlusher returns a flusher writing the statistics of reg into
+// coll every interval once started.
+func NewQueryStatsFlusher(reg *QueryStatsRegistry, coll *WrappedCollection, interval time.Duration) *QueryStatsFlusher {
+	host, _ := os.Hostname()
+	reg.keepWindows()
+	return &QueryStatsFlusher{reg: reg, coll: coll, interval: interval, host: host, lastFlush: time.Now()}
+}
+
+// Start starts flushing in the background until Stop is called.
+func (f *QueryStatsFlusher) Start() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.stop != nil {
+		return
+	}
+	f.stop, f.done = make(chan struct{}), make(chan struct{})
+	go f.run(f.stop, f.done)
+}
+
+func (f *QueryStatsFlusher) run(stop, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), f.interval)
+			if err := f.Flush(ctx); err != nil {
+				logf(f.Logger, "mongowrapper: flushing query statistics to %s: %v", f.coll.namespace(), err)
+			}
+			cancel()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Stop stops the background flushing and writes what was gathered since the
+// last flush.
+func (f *QueryStatsFlusher) Stop(ctx context.Context) error {
+	f.mu.Lock()
+	stop, done := f.stop, f.done
+	f.stop, f.done = nil, nil
+	f.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return f.Flush(ctx)
+}
+
+// Flush writes the statistics gathered since the previous flush. Should the
+// write fail, those statistics are lost.
+func (f *QueryStatsFlusher) Flush(ctx context.Context) error {
+	f.mu.Lock()
+	start, end := f.lastFlush, time.Now()
+	f.lastFlush = end
+	window := f.reg.flushWindow()
+	f.mu.Unlock()
+
+	if len(window) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, 0, len(window))
+	for _, qs := range window {
+		docs = append(docs, bson.D{
+			{Key: "fingerprint", Value: qs.Fingerprint},
+			{Key: "method", Value: qs.Method},
+			{Key: "namespace", Value: qs.Namespace},
+			{Key: "shape", Value: qs.Shape},
+			{Key: "host", Value: f.host},
+			{Key: "window_start", Value: start},
+			{Key: "window_end", Value: end},
+			{Key: "calls", Value: qs.Calls},
+			{Key: "errors", Value: qs.Errors},
+			{Key: "total_latency_ms", Value: durationMs(qs.TotalLatency)},
+			{Key: "min_latency_ms", Value: durationMs(qs.MinLatency)},
+			{Key: "max_latency_ms", Value: durationMs(qs.MaxLatency)},
+			{Key: "docs_returned", Value: qs.DocsReturned},
+		})
+	}
+	_, err := f.coll.withoutInterceptors().InsertMany(uninstrumented(ctx), docs)
+	return err
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / 1e6
+}
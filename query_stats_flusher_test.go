@@ -0,0 +1,130 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestQueryStatsFlusher(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	reg := mongowrapper.NewQueryStatsRegistry(0)
+	users := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), reg.Interceptor())
+	// The stats collection is instrumented too, to check that the flusher
+	// bypasses it.
+	statsColl := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("query_stats"), reg.Interceptor())
+	f := mongowrapper.NewQueryStatsFlusher(reg, statsColl, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		users.CountDocuments(ctx, bson.M{"age": i})
+	}
+	if err := f.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	users.CountDocuments(ctx, bson.M{"age": 9})
+	if err := f.Stop(ctx); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+
+	cur, err := statsColl.FindWrapped(ctx, bson.M{})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var docs []struct {
+		Namespace   string    `bson:"namespace"`
+		Shape       string    `bson:"shape"`
+		Calls       int64     `bson:"calls"`
+		WindowStart time.Time `bson:"window_start"`
+		WindowEnd   time.Time `bson:"window_end"`
+	}
+	if err := cur.All(ctx, &docs); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(docs) != 2 {
+		t.Fatalf("got %d stats documents, want one per flush: %+v", len(docs), docs)
+	}
+	if docs[0].Namespace != "db.users" || docs[0].Shape != `{"age":"?"}` || docs[0].Calls != 3 || docs[1].Calls != 1 {
+		t.Errorf("stats documents: got %+v", docs)
+	}
+	if docs[1].WindowStart.Before(docs[0].WindowEnd) {
+		t.Errorf("windows overlap: %+v", docs)
+	}
+
+	// Only the Find above reached the registry from the stats collection.
+	for _, qs := range reg.Snapshot() {
+		if qs.Namespace == "db.query_stats" && qs.Method != "go.mongodb.org/mongo-driver.Collection.Find" {
+			t.Errorf("flusher write was instrumented: %+v", qs)
+		}
+	}
+	if n, _ := rec.Calls("Collection.InsertMany"); n != 0 {
+		t.Errorf("flusher writes were measured: %d InsertMany calls", n)
+	}
+}
+
+func TestQueryStatsFlusherKeepsEvictedWindows(t *testing.T) {
+	reg := mongowrapper.NewQueryStatsRegistry(1)
+	users := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), reg.Interceptor())
+	statsColl := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("query_stats"))
+	f := mongowrapper.NewQueryStatsFlusher(reg, statsColl, time.Hour)
+	ctx := context.Background()
+
+	// The second shape evicts the first before it is flushed.
+	users.CountDocuments(ctx, bson.M{"age": 1})
+	users.CountDocuments(ctx, bson.M{"name": "a"})
+	if err := f.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	if n, _ := statsColl.CountDocuments(ctx, bson.M{}); n != 2 {
+		t.Errorf("got %d stats documents, want one per shape", n)
+	}
+	if err := f.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n, _ := statsColl.CountDocuments(ctx, bson.M{}); n != 2 {
+		t.Errorf("got %d stats documents after an idle flush, want 2", n)
+	}
+}
+
+func TestQueryStatsFlusherSkipsTenancy(t *testing.T) {
+	reg := mongowrapper.NewQueryStatsRegistry(0)
+	users := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), reg.Interceptor())
+	backend := mongowrappertest.NewCollection("query_stats")
+	statsColl := mongowrapper.NewCollection("db", backend, mongowrapper.TenancyInterceptor("tenant"))
+	f := mongowrapper.NewQueryStatsFlusher(reg, statsColl, time.Hour)
+	ctx := context.Background()
+
+	users.CountDocuments(ctx, bson.M{"age": 1})
+	// The flush is not made on behalf of a tenant.
+	if err := f.Flush(ctx); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if n, err := backend.CountDocuments(ctx, bson.M{}); err != nil || n != 1 {
+		t.Errorf("got %d stats documents, %v, want 1", n, err)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestQueryStatsRegistry(t *testing.T) {
+	reg := mongowrapper.NewQueryStatsRegistry(0)
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), reg.Interceptor())
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := coll.InsertOne(ctx, bson.M{"_id": i, "age": 20 + i}); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+	// The same shape with different values shares a fingerprint.
+	for _, age := range []int{21, 23} {
+		cur, err := coll.FindWrapped(ctx, bson.M{"age": bson.M{"$gte": age}})
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		var docs []bson.M
+		if err := cur.All(ctx, &docs); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+	}
+	if err := coll.FindOneWrapped(ctx, bson.M{"_id": 3}).Err(); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	coll.InsertOne(ctx, bson.M{"_id": 0})
+
+	byMethod := make(map[string]mongowrapper.QueryStats)
+	for _, qs := range reg.Snapshot() {
+		byMethod[qs.Method] = qs
+	}
+	if len(byMethod) != 3 {
+		t.Fatalf("got %d fingerprints, want 3: %+v", len(byMethod), reg.Snapshot())
+	}
+
+	find := byMethod["go.mongodb.org/mongo-driver.Collection.Find"]
+	if find.Calls != 2 || find.DocsReturned != 6 || find.Shape != `{"age":{"$gte":"?"}}` || find.Namespace != "db.users" {
+		t.Errorf("Find stats: got %+v", find)
+	}
+	if find.MinLatency > find.MaxLatency || find.TotalLatency < find.MaxLatency {
+		t.Errorf("Find latencies inconsistent: %+v", find)
+	}
+	if one := byMethod["go.mongodb.org/mongo-driver.Collection.FindOne"]; one.Calls != 1 || one.DocsReturned != 1 {
+		t.Errorf("FindOne stats: got %+v", one)
+	}
+	if ins := byMethod["go.mongodb.org/mongo-driver.Collection.InsertOne"]; ins.Calls != 6 || ins.Errors != 1 {
+		t.Errorf("InsertOne stats: got %+v", ins)
+	}
+
+	top := reg.Top(2)
+	if len(top) != 2 || top[0].TotalLatency < top[1].TotalLatency {
+		t.Errorf("Top(2): got %+v", top)
+	}
+}
+
+func TestQueryStatsFingerprintIgnoresKeyOrder(t *testing.T) {
+	reg := mongowrapper.NewQueryStatsRegistry(0)
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), reg.Interceptor())
+	ctx := context.Background()
+
+	// The keys of a bson.M are marshalled in random order.
+	for i := 0; i < 50; i++ {
+		filter := bson.M{"a": i, "b": i, "c": i, "d": bson.M{"x": i, "y": i, "z": i}}
+		if err := coll.FindOneWrapped(ctx, filter).Err(); err != mongo.ErrNoDocuments {
+			t.Fatalf("FindOne: %v", err)
+		}
+	}
+	snap := reg.Snapshot()
+	if len(snap) != 1 || snap[0].Calls != 50 {
+		t.Fatalf("got %+v, want a single fingerprint called 50 times", snap)
+	}
+	if want := `{"a":"?","b":"?","c":"?","d":{"x":"?","y":"?","z":"?"}}`; snap[0].Shape != want {
+		t.Errorf("Shape: got %s, want %s", snap[0].Shape, want)
+	}
+}
+
+func TestQueryStatsRegistryEviction(t *testing.T) {
+	reg := mongowrapper.NewQueryStatsRegistry(2)
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"), reg.Interceptor())
+	ctx := context.Background()
+
+	coll.CountDocuments(ctx, bson.M{"a": 1})
+	coll.CountDocuments(ctx, bson.M{"a": 1})
+	coll.CountDocuments(ctx, bson.M{"b": 1})
+	coll.CountDocuments(ctx, bson.M{"c": 1})
+
+	shapes := make(map[string]bool)
+	for _, qs := range reg.Snapshot() {
+		shapes[qs.Shape] = true
+	}
+	if len(shapes) != 2 || !shapes[`{"a":"?"}`] || !shapes[`{"c":"?"}`] {
+		t.Errorf("after eviction: got shapes %v, want the most called and the newest", shapes)
+	}
+}
+
+func TestQueryStatsDriverCursors(t *testing.T) {
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	reg := mongowrapper.NewQueryStatsRegistry(0)
+	client.SetQueryStatsRegistry(reg)
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	if _, err := srv.Collection("db", "users").InsertMany(ctx, []interface{}{bson.M{"_id": 1}, bson.M{"_id": 2}, bson.M{"_id": 3}}); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	coll := client.Database("db").Collection("users")
+
+	// Documents handed out by the driver cursor of Find are not seen by
+	// the wrapper; those of FindWrapped are.
+	cur, err := coll.Find(ctx, bson.M{"_id": bson.M{"$gt": 0}})
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var docs []bson.M
+	if err := cur.All(ctx, &docs); err != nil || len(docs) != 3 {
+		t.Fatalf("All: got %d documents, %v", len(docs), err)
+	}
+	wcur, err := coll.FindWrapped(ctx, bson.M{"_id": bson.M{"$gt": 0}})
+	if err != nil {
+		t.Fatalf("FindWrapped: %v", err)
+	}
+	if err := wcur.All(ctx, &docs); err != nil || len(docs) != 3 {
+		t.Fatalf("All: got %d documents, %v", len(docs), err)
+	}
+
+	snap := reg.Snapshot()
+	var find mongowrapper.QueryStats
+	for _, qs := range snap {
+		if qs.Method == "go.mongodb.org/mongo-driver.Collection.Find" {
+			find = qs
+		}
+	}
+	if find.Calls != 2 || find.DocsReturned != 3 {
+		t.Errorf("Find stats: got %+v, want 2 calls and the 3 documents of FindWrapped", find)
+	}
+}
+
+func TestQueryStatsShapes(t *testing.T) {
+	reg := mongowrapper.NewQueryStatsRegistry(0)
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("users"),
+		mongowrapper.TenancyInterceptor("tenant"), reg.Interceptor())
+	ctx := mongowrapper.ContextWithTenant(context.Background(), "acme")
+
+	pipelines := []mongo.Pipeline{
+		{{{Key: "$match", Value: bson.M{"a": 1}}}, {{Key: "$group", Value: bson.M{"_id": "$b"}}}},
+		{{{Key: "$match", Value: bson.M{"a": 1}}}, {{Key: "$sort", Value: bson.M{"b": 1}}}, {{Key: "$limit", Value: 5}}},
+	}
+	for _, p := range pipelines {
+		cur, err := coll.AggregateWrapped(ctx, p)
+		if err != nil {
+			t.Fatalf("Aggregate: %v", err)
+		}
+		cur.Close(ctx)
+	}
+	for _, filter := range []bson.M{
+		{"$or": bson.A{bson.M{"a": 1}, bson.M{"b": 1}}},
+		{"$or": bson.A{bson.M{"a": 1}, bson.M{"c": 1}}},
+		{"a": bson.M{"$in": bson.A{1, 2, 3}}},
+		{"a": bson.M{"$in": bson.A{4}}},
+	} {
+		cur, err := coll.FindWrapped(ctx, filter)
+		if err != nil {
+			t.Fatalf("Find: %v", err)
+		}
+		cur.Close(ctx)
+	}
+
+	shapes := make(map[string]int64)
+	for _, qs := range reg.Snapshot() {
+		shapes[qs.Shape] += qs.Calls
+	}
+	// Shapes are those of the calls as issued, before the tenancy
+	// interceptor adds its condition.
+	want := map[string]int64{
+		`[{"$match":{"a":"?"}},{"$group":{"_id":"?"}}]`:             1,
+		`[{"$match":{"a":"?"}},{"$sort":{"b":"?"}},{"$limit":"?"}]`: 1,
+		`{"$or":[{"a":"?"},{"b":"?"}]}`:                             1,
+		`{"$or":[{"a":"?"},{"c":"?"}]}`:                             1,
+		`{"a":{"$in":["?"]}}`:                                       2,
+	}
+	if !reflect.DeepEqual(shapes, want) {
+		t.Errorf("shapes: got %v, want %v", shapes, want)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"log"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+)
+
+// TrackedSession describes a live session started through a WrappedClient.
+type TrackedSession struct {
+	ID      string
+	Created time.Time
+	// Stack is the call stack StartSession was invoked from.
+	Stack string
+}
+
+// Age returns how long the session has been alive.
+func (ts TrackedSession) Age() time.Duration { return time.Since(ts.Created) }
+
+// SessionTracker keeps track of the sessions started through a WrappedClient
+// until they are ended, to find sessions that are never passed to EndSession.
+// Install one with WrappedClient.SetSessionTracker.
+type SessionTracker struct {
+	mu       sync.Mutex
+	sessions map[*WrappedSession]TrackedSession
+}
+
+func NewSessionTracker() *SessionTracker {
+	return &SessionTracker{sessions: make(map[*WrappedSession]TrackedSession)}
+}
+
+func (st *SessionTracker) track(ws *WrappedSession) {
+	ts := TrackedSession{ID: ws.ID(), Created: time.Now(), Stack: callerStack(2)}
+
+	st.mu.Lock()
+	st.sessions[ws] = ts
+	n := len(st.sessions)
+	st.mu.Unlock()
+
+	stats.Record(context.Background(), mLiveSessions.M(int64(n)))
+}
+
+func (st *SessionTracker) untrack(ws *WrappedSession) {
+	st.mu.Lock()
+	delete(st.sessions, ws)
+	n := len(st.sessions)
+	st.mu.Unlock()
+
+	stats.Record(context.Background(), mLiveSessions.M(int64(n)))
+}
+
+// Live returns the sessions that have not been ended yet, oldest first.
+func (st *SessionTracker) Live() []TrackedSession {
+	return st.Older(0)
+}
+
+// Older returns the live sessions older than threshold, oldest first.
+func (st *SessionTracker) Older(threshold time.Duration) []TrackedSession {
+	st.mu.Lock()
+	var tss []TrackedSession
+	for _, ts := range st.sessions {
+		if ts.Age() >= threshold {
+			tss = append(tss, ts)
+		}
+	}
+	st.mu.Unlock()
+
+	sort.Slice(tss, func(i, j int) bool { return tss[i].Created.Before(tss[j].Created) })
+	return tss
+}
+
+// LogOlder logs the live sessions older than threshold along with the stack
+// they were started from, returning how many were logged. A nil logger
+// logs to the standard logger.
+func (st *SessionTracker) LogOlder(logger *log.Logger, threshold time.Duration) int {
+	tss := st.Older(threshold)
+	for _, ts := range tss {
+		logf(logger, "mongowrapper: session %s alive for %s, started at:\n%s", ts.ID, ts.Age(), ts.Stack)
+	}
+	return len(tss)
+}
+
+func logf(logger *log.Logger, format string, args ...interface{}) {
+	if logger == nil {
+		log.Printf(format, args...)
+		return
+	}
+	logger.Printf(format, args...)
+}
+
+// callerStack formats the call stack of its caller, leaving out the
+// innermost skip frames.
+func callerStack(skip int) string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	var sb strings.Builder
+	for {
+		f, more := frames.Next()
+		sb.WriteString(f.Function)
+		sb.WriteString("\n\t")
+		sb.WriteString(f.File)
+		sb.WriteByte(':')
+		sb.WriteString(strconv.Itoa(f.Line))
+		sb.WriteByte('\n')
+		if !more {
+			break
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// operationShape returns the redacted shape of the filter of op or, for
+// aggregations, of its pipeline.
+func operationShape(op *Operation) string {
+	if op.Filter == nil {
+		return redactedShape(op.Pipeline)
+	}
+	return redactedShape(op.Filter)
+}
+
+// redactedShape renders a filter, update or pipeline as extended JSON with
+// every value replaced by "?", the keys of every document sorted and every
+// array reduced to the distinct shapes of its elements, in order, so that
+// operations differing only in their values, their number in a list such as
+// an $in, or the order of the keys of a map, have the same shape and no data
+// is disclosed. Every stage of a pipeline and every branch of an $or is
+// kept.
+func redactedShape(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	raw, err := bson.Marshal(bson.D{{Key: "v", Value: v}})
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+	b, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: redact(d[0].Value)}}, false, false)
+	if err != nil {
+		return fmt.Sprintf("%T", v)
+	}
+	// Strip the {"v": ...} envelope.
+	return string(b[len(`{"v":`) : len(b)-1])
+}
+
+func redact(v interface{}) interface{} {
+	switch v := v.(type) {
+	case bson.D:
+		out := make(bson.D, len(v))
+		for i, e := range v {
+			out[i] = bson.E{Key: e.Key, Value: redact(e.Value)}
+		}
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+		return out
+	case bson.A:
+		out := bson.A{}
+	elems:
+		for _, e := range v {
+			r := redact(e)
+			for _, seen := range out {
+				if reflect.DeepEqual(seen, r) {
+					continue elems
+				}
+			}
+			out = append(out, r)
+		}
+		return out
+	}
+	return "?"
+}
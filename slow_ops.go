@@ -0,0 +1,430 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// SlowOpRecord describes an operation slower than its threshold. It is
+// logged as JSON when the operation completes and, if the operation was
+// explained, again with its Plan.
+type SlowOpRecord struct {
+	Time        time.Time `json:"time"`
+	Method      string    `json:"method"`
+	Namespace   string    `json:"namespace"`
+	Shape       string    `json:"shape,omitempty"`
+	LatencyMs   float64   `json:"latency_ms"`
+	ThresholdMs float64   `json:"threshold_ms"`
+	Attribution string    `json:"attribution,omitempty"`
+	TraceID     string    `json:"trace_id,omitempty"`
+	SpanID      string    `json:"span_id,omitempty"`
+	Error       string    `json:"error,omitempty"`
+
+	Plan         *PlanSummary `json:"plan,omitempty"`
+	ExplainError string       `json:"explain_error,omitempty"`
+}
+
+// PlanSummary is the part of an explain reply that tells why a query is slow.
+type PlanSummary struct {
+	// Stages lists the stages of the winning plan from the root down, such
+	// as ["FETCH", "IXSCAN"].
+	Stages []string `json:"stages"`
+	// CollScan reports whether the plan scans the whole collection.
+	CollScan bool   `json:"collscan"`
+	Index    string `json:"index,omitempty"`
+
+	KeysExamined int64 `json:"keys_examined"`
+	DocsExamined int64 `json:"docs_examined"`
+	Returned     int64 `json:"returned"`
+}
+
+// ExplainFunc runs the explain command cmd against database and returns the
+// reply.
+type ExplainFunc func(ctx context.Context, database string, cmd bson.D) (bson.Raw, error)
+
+// explainTimeout bounds the explain of a slow operation.
+const explainTimeout = 30 * time.Second
+
+// SlowOpDetector reports the operations slower than a threshold: their span
+// gets the mongo.slow attribute, they are counted in the
+// mongo/client/slow_operations view and a SlowOpRecord is logged for each.
+// Install one with WrappedClient.SetSlowOpDetector.
+type SlowOpDetector struct {
+	// Logger receives the SlowOpRecords; nil means the standard logger.
+	Logger *log.Logger
+
+	mu         sync.Mutex
+	threshold  time.Duration
+	thresholds map[string]time.Duration
+
+	explainEvery time.Duration
+	lastExplain  time.Time
+	run          ExplainFunc
+	clientRun    ExplainFunc
+}
+
+// NewSlowOpDetector returns a detector reporting the operations that take
+// threshold or longer, unless SetThreshold overrides it for their namespace.
+func NewSlowOpDetector(threshold time.Duration) *SlowOpDetector {
+	return &SlowOpDetector{threshold: threshold, thresholds: make(map[string]time.Duration)}
+}
+
+// SetThreshold sets the threshold of namespace, "db.coll" or "db.*", with
+// "db.coll" taking precedence. A threshold of 0 turns detection off there.
+func (d *SlowOpDetector) SetThreshold(namespace string, threshold time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.thresholds[namespace] = threshold
+}
+
+// EnableExplain makes the detector re-run slow Find, Aggregate, Count and
+// CountDocuments calls with explain, in the background and at most once per
+// interval, and report the winning plan in a span following the slow one
+// and in a SlowOpRecord. Explains are run with run or, if it is nil, with
+// the client the detector is installed on. Aggregations writing with $out
+// or $merge are not explained.
+func (d *SlowOpDetector) EnableExplain(interval time.Duration, run ExplainFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.explainEvery, d.run = interval, run
+}
+
+// SetSlowOpDetector makes the client report its slow operations to d. It
+// must be called before the client is used.
+func (wc *WrappedClient) SetSlowOpDetector(d *SlowOpDetector) {
+	d.mu.Lock()
+	d.clientRun = func(ctx context.Context, database string, cmd bson.D) (bson.Raw, error) {
+		return wc.Database(database).RunCommand(ctx, cmd).DecodeBytes()
+	}
+	d.mu.Unlock()
+	wc.AddInterceptors(d.Interceptor())
+}
+
+// Interceptor returns the Interceptor behind SetSlowOpDetector, for use
+// with NewCollection. Calls without a database, such as the session and
+// transaction calls, are not checked, and neither are the Next and TryNext
+// calls of change streams, which wait for a change to happen.
+func (d *SlowOpDetector) Interceptor() Interceptor {
+	return func(ctx context.Context, op *Operation, invoke Invoker) error {
+		if isUninstrumented(ctx) || op.Database == "" || isChangeStreamWait(op) {
+			return invoke(ctx, op)
+		}
+		issued := issuedOperation(ctx, op)
+		start := time.Now()
+		err := invoke(ctx, op)
+		latency := time.Since(start)
+
+		if threshold := d.thresholdOf(op.Namespace()); threshold > 0 && latency >= threshold {
+			d.report(ctx, op, issued, latency, threshold, err)
+		}
+		return err
+	}
+}
+
+func (d *SlowOpDetector) thresholdOf(namespace string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if t, ok := d.thresholds[namespace]; ok {
+		return t
+	}
+	for pattern, t := range d.thresholds {
+		if matchNamespace(pattern, namespace) {
+			return t
+		}
+	}
+	return d.threshold
+}
+
+// report logs op, which ran slowly. The record shows the shape of the
+// operation as issued while the explain re-runs it as sent.
+func (d *SlowOpDetector) report(ctx context.Context, op, issued *Operation, latency, threshold time.Duration, err error) {
+	rec := &SlowOpRecord{
+		Time:        time.Now(),
+		Method:      op.ShortMethod(),
+		Namespace:   op.Namespace(),
+		Shape:       operationShape(issued),
+		LatencyMs:   float64(latency) / 1e6,
+		ThresholdMs: float64(threshold) / 1e6,
+		Attribution: AttributionFromContext(ctx),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	span := trace.FromContext(ctx)
+	if span != nil {
+		sc := span.SpanContext()
+		rec.TraceID, rec.SpanID = sc.TraceID.String(), sc.SpanID.String()
+		span.AddAttributes(
+			trace.BoolAttribute("mongo.slow", true),
+			trace.Int64Attribute("mongo.slow_threshold_ms", int64(threshold/time.Millisecond)),
+		)
+	}
+
+	tctx, _ := tag.New(ctx, tag.Upsert(keyMethod, op.Method), tag.Upsert(keyNamespace, op.Namespace()))
+	stats.Record(tctx, mSlowOps.M(1))
+	d.log(rec)
+
+	// Check that op can be explained first, so that operations that cannot
+	// do not use up the rate limit. The command holds the values of the
+	// caller, who may change them once the call returns, so it is encoded
+	// before explaining in the background.
+	cmd, ok := explainCommand(op)
+	if !ok {
+		return
+	}
+	raw, err := bson.Marshal(cmd)
+	if err != nil {
+		return
+	}
+	if run := d.explainer(); run != nil {
+		go d.explain(span, run, op.Method, op.Database, raw, rec)
+	}
+}
+
+// explainer returns the function to explain with if explains are enabled
+// and the rate limit allows one now.
+func (d *SlowOpDetector) explainer() ExplainFunc {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	run := d.run
+	if run == nil {
+		run = d.clientRun
+	}
+	if d.explainEvery <= 0 || run == nil || time.Since(d.lastExplain) < d.explainEvery {
+		return nil
+	}
+	d.lastExplain = time.Now()
+	return run
+}
+
+func (d *SlowOpDetector) explain(parent *trace.Span, run ExplainFunc, method, database string, raw bson.Raw, rec *SlowOpRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	name := method + ".Explain"
+	var span *trace.Span
+	if parent != nil {
+		ctx, span = trace.StartSpanWithRemoteParent(ctx, name, parent.SpanContext())
+	} else {
+		ctx, span = trace.StartSpan(ctx, name)
+	}
+	defer span.End()
+
+	// The explain is neither traced, measured nor intercepted by the
+	// detector again.
+	var cmd bson.D
+	var reply bson.Raw
+	err := bson.Unmarshal(raw, &cmd)
+	if err == nil {
+		reply, err = run(uninstrumented(ctx), database, cmd)
+	}
+	var plan *PlanSummary
+	if err == nil {
+		plan, err = summarizePlan(reply)
+	}
+
+	follow := *rec
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+		follow.ExplainError = err.Error()
+	} else {
+		span.AddAttributes(
+			trace.StringAttribute("mongo.plan", strings.Join(plan.Stages, ">")),
+			trace.BoolAttribute("mongo.plan_collscan", plan.CollScan),
+			trace.StringAttribute("mongo.plan_index", plan.Index),
+			trace.Int64Attribute("mongo.plan_keys_examined", plan.KeysExamined),
+			trace.Int64Attribute("mongo.plan_docs_examined", plan.DocsExamined),
+			trace.Int64Attribute("mongo.plan_returned", plan.Returned),
+		)
+		follow.Plan = plan
+	}
+	d.log(&follow)
+}
+
+func (d *SlowOpDetector) log(rec *SlowOpRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		logf(d.Logger, "mongowrapper: encoding slow operation record: %v", err)
+		return
+	}
+	logf(d.Logger, "mongowrapper: slow operation: %s", b)
+}
+
+// explainCommand returns the explain command re-running op, if it is a
+// read that can be explained.
+func explainCommand(op *Operation) (bson.D, bool) {
+	filter := op.Filter
+	if filter == nil {
+		filter = bson.D{}
+	}
+
+	var cmd bson.D
+	switch op.ShortMethod() {
+	case "Collection.Find":
+		cmd = bson.D{{Key: "find", Value: op.Collection}, {Key: "filter", Value: filter}}
+		if opts, ok := op.Options.([]*options.FindOptions); ok {
+			fo := options.MergeFindOptions(opts...)
+			cmd = appendOptional(cmd, "sort", fo.Sort)
+			cmd = appendOptional(cmd, "projection", fo.Projection)
+			cmd = appendOptional(cmd, "hint", fo.Hint)
+			if fo.Skip != nil {
+				cmd = append(cmd, bson.E{Key: "skip", Value: *fo.Skip})
+			}
+			if fo.Limit != nil {
+				cmd = append(cmd, bson.E{Key: "limit", Value: *fo.Limit})
+			}
+		}
+	case "Collection.Aggregate":
+		stages, err := pipelineStages(op.Pipeline)
+		if err != nil {
+			return nil, false
+		}
+		for _, stage := range stages {
+			if s, ok := stage.(bson.D); ok && len(s) > 0 && (s[0].Key == "$out" || s[0].Key == "$merge") {
+				return nil, false
+			}
+		}
+		cmd = bson.D{{Key: "aggregate", Value: op.Collection}, {Key: "pipeline", Value: stages}, {Key: "cursor", Value: bson.D{}}}
+		if opts, ok := op.Options.([]*options.AggregateOptions); ok {
+			cmd = appendOptional(cmd, "hint", options.MergeAggregateOptions(opts...).Hint)
+		}
+	case "Collection.Count", "Collection.CountDocuments":
+		cmd = bson.D{{Key: "count", Value: op.Collection}, {Key: "query", Value: filter}}
+		if opts, ok := op.Options.([]*options.CountOptions); ok {
+			co := options.MergeCountOptions(opts...)
+			cmd = appendOptional(cmd, "hint", co.Hint)
+			if co.Skip != nil {
+				cmd = append(cmd, bson.E{Key: "skip", Value: *co.Skip})
+			}
+			if co.Limit != nil {
+				cmd = append(cmd, bson.E{Key: "limit", Value: *co.Limit})
+			}
+		}
+	default:
+		return nil, false
+	}
+	return bson.D{{Key: "explain", Value: cmd}, {Key: "verbosity", Value: "executionStats"}}, true
+}
+
+func appendOptional(cmd bson.D, key string, value interface{}) bson.D {
+	if value == nil {
+		return cmd
+	}
+	return append(cmd, bson.E{Key: key, Value: value})
+}
+
+// summarizePlan extracts the winning plan and execution statistics from an
+// explain reply, wherever they are nested, as for aggregations.
+func summarizePlan(reply bson.Raw) (*PlanSummary, error) {
+	planner, ok := findExplainField(reply, "queryPlanner")
+	if !ok {
+		return nil, errors.New("mongowrapper: no queryPlanner in the explain reply")
+	}
+	ps := new(PlanSummary)
+	if plan, err := planner.LookupErr("winningPlan"); err == nil {
+		if doc, ok := plan.DocumentOK(); ok {
+			ps.walk(doc)
+		}
+	}
+	if exec, ok := findExplainField(reply, "executionStats"); ok {
+		ps.KeysExamined = explainInt(exec.Lookup("totalKeysExamined"))
+		ps.DocsExamined = explainInt(exec.Lookup("totalDocsExamined"))
+		ps.Returned = explainInt(exec.Lookup("nReturned"))
+	}
+	return ps, nil
+}
+
+// walk follows plan down its first input stages.
+func (ps *PlanSummary) walk(plan bson.Raw) {
+	for plan != nil {
+		if stage, ok := plan.Lookup("stage").StringValueOK(); ok {
+			ps.Stages = append(ps.Stages, stage)
+			if stage == "COLLSCAN" {
+				ps.CollScan = true
+			}
+		}
+		if index, ok := plan.Lookup("indexName").StringValueOK(); ok && ps.Index == "" {
+			ps.Index = index
+		}
+
+		var next bson.Raw
+		if doc, ok := plan.Lookup("inputStage").DocumentOK(); ok {
+			next = doc
+		} else if doc, ok := plan.Lookup("queryPlan").DocumentOK(); ok {
+			next = doc
+		} else if arr, ok := plan.Lookup("inputStages").ArrayOK(); ok {
+			if first, err := arr.IndexErr(0); err == nil {
+				next, _ = first.Value().DocumentOK()
+			}
+		}
+		plan = next
+	}
+}
+
+// findExplainField returns the first document named key found depth first
+// in doc.
+func findExplainField(doc bson.Raw, key string) (bson.Raw, bool) {
+	elems, err := doc.Elements()
+	if err != nil {
+		return nil, false
+	}
+	for _, e := range elems {
+		if sub, ok := e.Value().DocumentOK(); ok && e.Key() == key {
+			return sub, true
+		}
+	}
+	for _, e := range elems {
+		var sub bson.Raw
+		switch v := e.Value(); v.Type {
+		case bson.TypeEmbeddedDocument:
+			sub = v.Document()
+		case bson.TypeArray:
+			sub = v.Array()
+		default:
+			continue
+		}
+		if found, ok := findExplainField(sub, key); ok {
+			return found, true
+		}
+	}
+	return nil, false
+}
+
+func explainInt(v bson.RawValue) int64 {
+	switch v.Type {
+	case bson.TypeInt32:
+		return int64(v.Int32())
+	case bson.TypeInt64:
+		return v.Int64()
+	case bson.TypeDouble:
+		return int64(v.Double())
+	}
+	return 0
+}
@@ -0,0 +1,208 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/stats/view"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSlowOpDetector(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	client.SetFaultInjector(mongowrapper.NewFaultInjector(1,
+		mongowrapper.FaultRule{Namespace: "db.slow", Latency: 20 * time.Millisecond, Probability: 1}))
+	var logs syncBuffer
+	d := mongowrapper.NewSlowOpDetector(time.Hour)
+	d.Logger = log.New(&logs, "", 0)
+	d.SetThreshold("db.slow", 10*time.Millisecond)
+	d.EnableExplain(time.Hour, nil)
+	client.SetSlowOpDetector(d)
+
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	docs := []interface{}{bson.M{"_id": 1, "n": 1}, bson.M{"_id": 2, "n": 2}, bson.M{"_id": 3, "n": 1}}
+	for _, name := range []string{"slow", "fast"} {
+		if _, err := srv.Collection("db", name).InsertMany(ctx, docs); err != nil {
+			t.Fatalf("InsertMany: %v", err)
+		}
+		for i := 0; i < 2; i++ {
+			cur, err := client.Database("db").Collection(name).Find(ctx, bson.M{"n": 1})
+			if err != nil {
+				t.Fatalf("Find on %s: %v", name, err)
+			}
+			cur.Close(ctx)
+		}
+	}
+
+	rows, err := rec.Rows("mongo/client/slow_operations")
+	if err != nil {
+		t.Fatalf("Rows: %v", err)
+	}
+	var slow int64
+	for _, row := range rows {
+		slow += row.Data.(*view.CountData).Value
+	}
+	if slow != 2 {
+		t.Errorf("slow operations: got %d, want 2", slow)
+	}
+	find := rec.AssertSpan(t, "Collection.Find", map[string]interface{}{"mongo.slow": true}, 0)
+
+	// Only the first slow Find is explained, in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for len(rec.SpansNamed("Collection.Find.Explain")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	explain := rec.AssertSpan(t, "Collection.Find.Explain", map[string]interface{}{
+		"mongo.plan":               "COLLSCAN",
+		"mongo.plan_collscan":      true,
+		"mongo.plan_docs_examined": int64(3),
+		"mongo.plan_returned":      int64(2),
+		"mongo.plan_keys_examined": int64(0),
+	}, 0)
+	if explain.TraceID != find.TraceID {
+		t.Errorf("explain span is not in the trace of the slow Find")
+	}
+	if n := len(rec.SpansNamed("Collection.Find.Explain")); n != 1 {
+		t.Errorf("explains: got %d, want 1", n)
+	}
+
+	out := logs.String()
+	if n := strings.Count(out, "mongowrapper: slow operation: "); n != 3 {
+		t.Errorf("slow operation records: got %d, want 3:\n%s", n, out)
+	}
+	for _, want := range []string{`"namespace":"db.slow"`, `"shape":"{\"n\":\"?\"}"`, `"collscan":true`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("records lack %s:\n%s", want, out)
+		}
+	}
+}
+
+func TestSlowOpDetectorExplainRateLimit(t *testing.T) {
+	fi := mongowrapper.NewFaultInjector(1, mongowrapper.FaultRule{Latency: 20 * time.Millisecond, Probability: 1})
+	d := mongowrapper.NewSlowOpDetector(10 * time.Millisecond)
+	d.Logger = log.New(&syncBuffer{}, "", 0)
+	explained := make(chan string, 2)
+	d.EnableExplain(time.Hour, func(ctx context.Context, database string, cmd bson.D) (bson.Raw, error) {
+		find := cmd[0].Value.(bson.D)
+		explained <- find[0].Key
+		if got := find.Map()["filter"].(bson.D).Map()["n"]; got != int32(1) {
+			t.Errorf("explained filter n: got %v, want 1", got)
+		}
+		return bson.Marshal(bson.M{"ok": 1})
+	})
+	coll := mongowrapper.NewCollection("db", fi.Wrap("db", mongowrappertest.NewCollection("slow")), d.Interceptor())
+	ctx := context.Background()
+
+	// The slow insert cannot be explained and leaves the rate limit to the
+	// slow Find that follows.
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 1}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	filter := bson.M{"n": 1}
+	cur, err := coll.FindWrapped(ctx, filter)
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	cur.Close(ctx)
+	// The filter is the caller's again and is explained as it was.
+	filter["n"] = 2
+
+	select {
+	case cmd := <-explained:
+		if cmd != "find" {
+			t.Errorf("explained %q, want find", cmd)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the slow Find was not explained")
+	}
+}
+
+func TestSlowOpDetectorSkipsChangeStreamWaits(t *testing.T) {
+	var logs syncBuffer
+	d := mongowrapper.NewSlowOpDetector(time.Millisecond)
+	d.Logger = log.New(&logs, "", 0)
+	r := mongowrapper.NewQueryStatsRegistry(10)
+	wait := func(ctx context.Context, op *mongowrapper.Operation) error {
+		time.Sleep(5 * time.Millisecond)
+		return nil
+	}
+
+	ctx := context.Background()
+	for _, method := range []string{"ChangeStream.Next", "ChangeStream.TryNext"} {
+		op := &mongowrapper.Operation{Method: "go.mongodb.org/mongo-driver." + method, Database: "db", Collection: "a"}
+		if err := d.Interceptor()(ctx, op, wait); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+		if err := r.Interceptor()(ctx, op, wait); err != nil {
+			t.Fatalf("%s: %v", method, err)
+		}
+	}
+	if out := logs.String(); out != "" {
+		t.Errorf("change stream waits reported as slow:\n%s", out)
+	}
+	if stats := r.Snapshot(); len(stats) != 0 {
+		t.Errorf("change stream waits in query stats: %+v", stats)
+	}
+}
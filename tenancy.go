@@ -0,0 +1,324 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// TenancyError is returned for operations on a tenant-scoped collection that
+// cannot be restricted to the tenant of their context.
+type TenancyError struct {
+	Method    string
+	Namespace string
+	Reason    string
+}
+
+func (e *TenancyError) Error() string {
+	return fmt.Sprintf("mongowrapper: %s on tenant-scoped %s: %s", e.Method, e.Namespace, e.Reason)
+}
+
+type tenantKey struct{}
+
+// ContextWithTenant returns a copy of ctx carrying tenant, the ID the
+// operations on tenant-scoped collections made with it are restricted to.
+func ContextWithTenant(ctx context.Context, tenant interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// TenantFromContext returns the tenant set by ContextWithTenant.
+func TenantFromContext(ctx context.Context) (tenant interface{}, ok bool) {
+	tenant = ctx.Value(tenantKey{})
+	return tenant, tenant != nil
+}
+
+// SetTenancy scopes the collections of the client to the tenant of the
+// context, stored in field of their documents. Namespaces are "db.coll" or
+// "db.*"; without any, every collection is scoped. It must be called before
+// the client is used.
+func (wc *WrappedClient) SetTenancy(field string, namespaces ...string) {
+	wc.AddInterceptors(TenancyInterceptor(field, namespaces...))
+}
+
+// TenancyInterceptor returns the Interceptor behind SetTenancy, for use with
+// NewCollection. On the scoped collections it adds the tenant as a condition
+// to the filters of reads, updates and deletes, as a first $match stage to
+// aggregations and as a field to inserted and replacing documents. Calls
+// without a tenant, inserts and replacements with documents of another
+// tenant, updates that change the tenant field and calls that cannot be
+// scoped (EstimatedDocumentCount, Drop and Watch) fail with a *TenancyError.
+func TenancyInterceptor(field string, namespaces ...string) Interceptor {
+	return func(ctx context.Context, op *Operation, invoke Invoker) error {
+		if !strings.HasPrefix(op.ShortMethod(), "Collection.") || !tenantScoped(namespaces, op.Namespace()) {
+			return invoke(ctx, op)
+		}
+		fail := func(reason string) error {
+			return &TenancyError{Method: op.ShortMethod(), Namespace: op.Namespace(), Reason: reason}
+		}
+		tenant, ok := TenantFromContext(ctx)
+		if !ok {
+			return fail("no tenant in the context")
+		}
+
+		ts := tenantScope{field: field, tenant: tenant}
+		unscoped := *op
+		ctx = context.WithValue(ctx, unscopedOperationKey{}, &unscoped)
+		var err error
+		switch op.ShortMethod() {
+		case "Collection.EstimatedDocumentCount", "Collection.Drop", "Collection.Watch":
+			return fail("the operation cannot be restricted to a tenant")
+		case "Collection.Aggregate":
+			op.Pipeline, err = ts.pipeline(op.Pipeline)
+		case "Collection.InsertOne", "Collection.InsertMany":
+			docs := make([]interface{}, len(op.Documents))
+			for i, doc := range op.Documents {
+				if docs[i], err = ts.document(doc); err != nil {
+					break
+				}
+			}
+			op.Documents = docs
+		case "Collection.ReplaceOne", "Collection.FindOneAndReplace":
+			op.Filter = ts.filter(op.Filter)
+			op.Update, err = ts.document(op.Update)
+		case "Collection.UpdateOne", "Collection.UpdateMany", "Collection.FindOneAndUpdate":
+			op.Filter = ts.filter(op.Filter)
+			err = ts.update(op.Update)
+		case "Collection.BulkWrite":
+			op.Models, err = ts.models(op.Models)
+		default:
+			op.Filter = ts.filter(op.Filter)
+		}
+		if err != nil {
+			return fail(err.Error())
+		}
+		return invoke(ctx, op)
+	}
+}
+
+// unscopedOperationKey holds a copy of the operation as issued, before it is
+// restricted to a tenant, for the interceptors that follow.
+type unscopedOperationKey struct{}
+
+// issuedOperation returns a copy of op as the caller issued it, before the
+// tenancy interceptor restricted it to a tenant, whatever the place of the
+// calling interceptor in the chain. It must be called before invoking op,
+// which the tenancy interceptor changes in place.
+func issuedOperation(ctx context.Context, op *Operation) *Operation {
+	if unscoped, ok := ctx.Value(unscopedOperationKey{}).(*Operation); ok {
+		op = unscoped
+	}
+	issued := *op
+	return &issued
+}
+
+func tenantScoped(namespaces []string, namespace string) bool {
+	if len(namespaces) == 0 {
+		return true
+	}
+	for _, ns := range namespaces {
+		if matchNamespace(ns, namespace) {
+			return true
+		}
+	}
+	return false
+}
+
+type tenantScope struct {
+	field  string
+	tenant interface{}
+}
+
+// filter returns filter restricted to the tenant. The original conditions
+// are kept in an $and, so that they cannot override the tenant's.
+func (ts tenantScope) filter(filter interface{}) interface{} {
+	cond := bson.D{{Key: ts.field, Value: ts.tenant}}
+	if isEmptyFilter(filter) {
+		return cond
+	}
+	return bson.D{{Key: "$and", Value: bson.A{cond, filter}}}
+}
+
+// document returns a copy of doc holding the tenant's field.
+func (ts tenantScope) document(doc interface{}) (interface{}, error) {
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(raw, &d); err != nil {
+		return nil, err
+	}
+	for _, e := range d {
+		if e.Key != ts.field {
+			continue
+		}
+		if !sameTenant(e.Value, ts.tenant) {
+			return nil, fmt.Errorf("the document belongs to tenant %v", e.Value)
+		}
+		return d, nil
+	}
+	return append(d, bson.E{Key: ts.field, Value: ts.tenant}), nil
+}
+
+// update returns an error if update, an update document or pipeline, sets,
+// unsets, renames or replaces the tenant's field.
+func (ts tenantScope) update(update interface{}) error {
+	raw, err := bson.Marshal(bson.D{{Key: "u", Value: update}})
+	if err != nil {
+		// Let the driver report the invalid update.
+		return nil
+	}
+	var wrapper struct {
+		U interface{} `bson:"u"`
+	}
+	if err := bson.Unmarshal(raw, &wrapper); err != nil {
+		return nil
+	}
+	stages, ok := wrapper.U.(bson.A)
+	if !ok {
+		stages = bson.A{wrapper.U}
+	}
+	for _, stage := range stages {
+		ops, _ := stage.(bson.D)
+		for _, op := range ops {
+			switch op.Key {
+			case "$replaceRoot", "$replaceWith":
+				return fmt.Errorf("the update replaces the document, and so field %s", ts.field)
+			case "$unset":
+				// In pipelines, $unset takes a field or an array of fields.
+				if f, ok := op.Value.(string); ok && ts.touches(f) {
+					return ts.errUpdate()
+				}
+				if fs, ok := op.Value.(bson.A); ok {
+					for _, f := range fs {
+						if f, ok := f.(string); ok && ts.touches(f) {
+							return ts.errUpdate()
+						}
+					}
+				}
+			}
+			fields, _ := op.Value.(bson.D)
+			for _, f := range fields {
+				if ts.touches(f.Key) {
+					return ts.errUpdate()
+				}
+				if to, ok := f.Value.(string); ok && op.Key == "$rename" && ts.touches(to) {
+					return ts.errUpdate()
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// touches reports whether path is the tenant's field or one of its
+// subfields.
+func (ts tenantScope) touches(path string) bool {
+	return path == ts.field || strings.HasPrefix(path, ts.field+".")
+}
+
+func (ts tenantScope) errUpdate() error {
+	return fmt.Errorf("the update changes field %s", ts.field)
+}
+
+func sameTenant(a, b interface{}) bool {
+	ra, err := bson.Marshal(bson.D{{Key: "t", Value: a}})
+	if err != nil {
+		return false
+	}
+	rb, err := bson.Marshal(bson.D{{Key: "t", Value: b}})
+	return err == nil && bson.Raw(ra).Lookup("t").Equal(bson.Raw(rb).Lookup("t"))
+}
+
+// pipeline returns pipeline preceded by a $match on the tenant.
+func (ts tenantScope) pipeline(pipeline interface{}) (interface{}, error) {
+	stages, err := pipelineStages(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	match := bson.D{{Key: "$match", Value: bson.D{{Key: ts.field, Value: ts.tenant}}}}
+	return append(bson.A{match}, stages...), nil
+}
+
+// pipelineStages converts pipeline, such as a mongo.Pipeline or a []bson.M,
+// to an array of bson.D stages.
+func pipelineStages(pipeline interface{}) (bson.A, error) {
+	raw, err := bson.Marshal(bson.D{{Key: "p", Value: pipeline}})
+	if err != nil {
+		return nil, err
+	}
+	var wrapper struct {
+		P bson.A `bson:"p"`
+	}
+	if err := bson.Unmarshal(raw, &wrapper); err != nil {
+		return nil, err
+	}
+	return wrapper.P, nil
+}
+
+// models returns copies of models restricted to the tenant.
+func (ts tenantScope) models(models []mongo.WriteModel) ([]mongo.WriteModel, error) {
+	scoped := make([]mongo.WriteModel, len(models))
+	for i, m := range models {
+		switch m := m.(type) {
+		case *mongo.InsertOneModel:
+			doc, err := ts.document(m.Document)
+			if err != nil {
+				return nil, err
+			}
+			c := *m
+			c.Document = doc
+			scoped[i] = &c
+		case *mongo.ReplaceOneModel:
+			doc, err := ts.document(m.Replacement)
+			if err != nil {
+				return nil, err
+			}
+			c := *m
+			c.Filter, c.Replacement = ts.filter(m.Filter), doc
+			scoped[i] = &c
+		case *mongo.UpdateOneModel:
+			if err := ts.update(m.Update); err != nil {
+				return nil, err
+			}
+			c := *m
+			c.Filter = ts.filter(m.Filter)
+			scoped[i] = &c
+		case *mongo.UpdateManyModel:
+			if err := ts.update(m.Update); err != nil {
+				return nil, err
+			}
+			c := *m
+			c.Filter = ts.filter(m.Filter)
+			scoped[i] = &c
+		case *mongo.DeleteOneModel:
+			c := *m
+			c.Filter = ts.filter(m.Filter)
+			scoped[i] = &c
+		case *mongo.DeleteManyModel:
+			c := *m
+			c.Filter = ts.filter(m.Filter)
+			scoped[i] = &c
+		default:
+			return nil, fmt.Errorf("unsupported write model %T", m)
+		}
+	}
+	return scoped, nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestTenancy(t *testing.T) {
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("orders"),
+		mongowrapper.TenancyInterceptor("tenant_id", "db.orders"))
+	acme := mongowrapper.ContextWithTenant(context.Background(), "acme")
+	globex := mongowrapper.ContextWithTenant(context.Background(), "globex")
+
+	if _, err := coll.InsertMany(acme, []interface{}{bson.M{"_id": 1, "n": 1}, bson.M{"_id": 2, "n": 2}}); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	if _, err := coll.InsertOne(globex, bson.M{"_id": 3, "n": 1}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	if _, err := coll.BulkWrite(globex, []mongo.WriteModel{mongo.NewInsertOneModel().SetDocument(bson.M{"_id": 4, "n": 2})}); err != nil {
+		t.Fatalf("BulkWrite: %v", err)
+	}
+
+	count := func(ctx context.Context, filter interface{}) int64 {
+		t.Helper()
+		n, err := coll.CountDocuments(ctx, filter)
+		if err != nil {
+			t.Fatalf("CountDocuments: %v", err)
+		}
+		return n
+	}
+	if n := count(acme, bson.M{}); n != 2 {
+		t.Errorf("acme documents: got %d want 2", n)
+	}
+	// The caller's conditions cannot widen the tenant's.
+	if n := count(acme, bson.M{"tenant_id": "globex"}); n != 0 {
+		t.Errorf("acme documents of globex: got %d want 0", n)
+	}
+
+	var doc bson.M
+	if err := coll.FindOneWrapped(globex, bson.M{"n": 1}).Decode(&doc); err != nil {
+		t.Fatalf("FindOne: %v", err)
+	}
+	if doc["_id"] != int32(3) || doc["tenant_id"] != "globex" {
+		t.Errorf("FindOne: got %v", doc)
+	}
+
+	res, err := coll.UpdateMany(acme, bson.M{"n": 1}, bson.M{"$set": bson.M{"seen": true}})
+	if err != nil {
+		t.Fatalf("UpdateMany: %v", err)
+	}
+	if res.MatchedCount != 1 {
+		t.Errorf("UpdateMany matched %d want 1", res.MatchedCount)
+	}
+	if _, err := coll.UpdateOne(acme, bson.M{"_id": 5}, bson.M{"$set": bson.M{"n": 5}}, options.Update().SetUpsert(true)); err != nil {
+		t.Fatalf("UpdateOne upsert: %v", err)
+	}
+	if n := count(acme, bson.M{"_id": 5}); n != 1 {
+		t.Errorf("upserted document not owned by acme")
+	}
+
+	del, err := coll.DeleteMany(globex, bson.M{})
+	if err != nil {
+		t.Fatalf("DeleteMany: %v", err)
+	}
+	if del.DeletedCount != 2 {
+		t.Errorf("DeleteMany deleted %d want 2", del.DeletedCount)
+	}
+	if n := count(acme, bson.M{}); n != 3 {
+		t.Errorf("acme documents after globex delete: got %d want 3", n)
+	}
+
+	cur, err := coll.AggregateWrapped(acme, mongo.Pipeline{{{Key: "$match", Value: bson.M{"n": 1}}}})
+	if err != nil {
+		t.Fatalf("Aggregate: %v", err)
+	}
+	var docs []bson.M
+	if err := cur.All(acme, &docs); err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(docs) != 1 || docs[0]["_id"] != int32(1) {
+		t.Errorf("Aggregate: got %v", docs)
+	}
+
+	for _, tt := range []struct {
+		name string
+		call func() error
+	}{
+		{"no tenant", func() error {
+			_, err := coll.FindWrapped(context.Background(), bson.M{})
+			return err
+		}},
+		{"other tenant's document", func() error {
+			_, err := coll.InsertOne(acme, bson.M{"tenant_id": "globex"})
+			return err
+		}},
+		{"update of the tenant field", func() error {
+			_, err := coll.UpdateOne(acme, bson.M{"_id": 1}, bson.M{"$set": bson.M{"tenant_id": "globex"}})
+			return err
+		}},
+		{"rename to the tenant field", func() error {
+			_, err := coll.UpdateMany(acme, bson.M{}, bson.M{"$rename": bson.M{"owner": "tenant_id"}})
+			return err
+		}},
+		{"pipeline unsetting the tenant field", func() error {
+			_, err := coll.UpdateOne(acme, bson.M{"_id": 1}, mongo.Pipeline{{{Key: "$unset", Value: "tenant_id"}}})
+			return err
+		}},
+		{"bulk update of the tenant field", func() error {
+			_, err := coll.BulkWrite(acme, []mongo.WriteModel{
+				mongo.NewUpdateManyModel().SetFilter(bson.M{}).SetUpdate(bson.M{"$unset": bson.M{"tenant_id.region": ""}}),
+			})
+			return err
+		}},
+		{"unscopable", func() error {
+			_, err := coll.EstimatedDocumentCount(acme)
+			return err
+		}},
+	} {
+		if _, ok := tt.call().(*mongowrapper.TenancyError); !ok {
+			t.Errorf("%s: want a *TenancyError", tt.name)
+		}
+	}
+
+	// A replacement without the tenant field keeps the document the
+	// tenant's.
+	if _, err := coll.ReplaceOne(acme, bson.M{"_id": 1}, bson.M{"n": 10}); err != nil {
+		t.Fatalf("ReplaceOne: %v", err)
+	}
+	if n := count(acme, bson.M{"_id": 1, "n": 10}); n != 1 {
+		t.Errorf("replaced document not owned by acme")
+	}
+
+	other := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("audit"),
+		mongowrapper.TenancyInterceptor("tenant_id", "db.orders"))
+	if _, err := other.InsertOne(context.Background(), bson.M{"_id": 1}); err != nil {
+		t.Errorf("InsertOne on an unscoped collection: %v", err)
+	}
+}
@@ -0,0 +1,315 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"io"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+)
+
+// WrappedBucket is a traced GridFS bucket. The GridFS API of the driver does
+// not take contexts, so the contexts passed to the methods of WrappedBucket
+// only go through the interceptors, parent the spans and carry the tags of
+// the recorded measurements.
+type WrappedBucket struct {
+	b         *gridfs.Bucket
+	database  string
+	name      string
+	chunkSize int32
+	cfg       *config
+}
+
+// NewBucket creates a GridFS bucket in the database wrapped by wd.
+func NewBucket(wd *WrappedDatabase, opts ...*options.BucketOptions) (*WrappedBucket, error) {
+	b, err := gridfs.NewBucket(wd.db, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	name, chunkSize := "fs", gridfs.DefaultChunkSize
+	bo := options.MergeBucketOptions(opts...)
+	if bo.Name != nil {
+		name = *bo.Name
+	}
+	if bo.ChunkSizeBytes != nil {
+		chunkSize = *bo.ChunkSizeBytes
+	}
+	return &WrappedBucket{b: b, database: wd.db.Name(), name: name, chunkSize: chunkSize, cfg: wd.cfg}, nil
+}
+
+func (wb *WrappedBucket) UploadFromStream(ctx context.Context, filename string, source io.Reader, opts ...*options.UploadOptions) (primitive.ObjectID, error) {
+	op := wb.operation("UploadFromStream")
+	op.Options = opts
+
+	var id primitive.ObjectID
+	err := wb.intercept(ctx, op, filename, func(ctx context.Context, op *Operation) (err error) {
+		cr := &countingReader{r: source}
+		id, err = wb.b.UploadFromStream(filename, cr, opts...)
+		op.Result = id
+		recordTransfer(ctx, trace.FromContext(ctx), op.Method, cr.n, uploadChunkSize(wb.chunkSize, opts))
+		return err
+	})
+	return id, err
+}
+
+// OpenUploadStream opens a stream to upload a file to. The stream gets a
+// span of its own, lasting until it is closed or aborted.
+func (wb *WrappedBucket) OpenUploadStream(ctx context.Context, filename string, opts ...*options.UploadOptions) (*WrappedUploadStream, error) {
+	op := wb.operation("OpenUploadStream")
+	op.Options = opts
+
+	var wus *WrappedUploadStream
+	err := wb.intercept(ctx, op, filename, func(_ context.Context, op *Operation) error {
+		us, err := wb.b.OpenUploadStream(filename, opts...)
+		if err != nil {
+			return err
+		}
+		sctx, span := wb.streamSpan(ctx, "UploadStream", filename)
+		wus = &WrappedUploadStream{UploadStream: us, ctx: sctx, span: span, chunkSize: uploadChunkSize(wb.chunkSize, opts)}
+		op.Result = wus
+		return nil
+	})
+	return wus, err
+}
+
+func (wb *WrappedBucket) DownloadToStream(ctx context.Context, fileID interface{}, stream io.Writer) (int64, error) {
+	var n int64
+	err := wb.intercept(ctx, wb.operation("DownloadToStream"), "", func(ctx context.Context, op *Operation) (err error) {
+		n, err = wb.b.DownloadToStream(fileID, stream)
+		op.Result = n
+		recordTransfer(ctx, trace.FromContext(ctx), op.Method, n, wb.chunkSize)
+		return err
+	})
+	return n, err
+}
+
+// OpenDownloadStream opens a stream to download a file from. The stream gets
+// a span of its own, lasting until it is closed.
+func (wb *WrappedBucket) OpenDownloadStream(ctx context.Context, fileID interface{}) (*WrappedDownloadStream, error) {
+	var wds *WrappedDownloadStream
+	err := wb.intercept(ctx, wb.operation("OpenDownloadStream"), "", func(_ context.Context, op *Operation) error {
+		ds, err := wb.b.OpenDownloadStream(fileID)
+		if err != nil {
+			return err
+		}
+		sctx, span := wb.streamSpan(ctx, "DownloadStream", "")
+		wds = &WrappedDownloadStream{DownloadStream: ds, ctx: sctx, span: span, chunkSize: wb.chunkSize}
+		op.Result = wds
+		return nil
+	})
+	return wds, err
+}
+
+func (wb *WrappedBucket) Delete(ctx context.Context, fileID interface{}) error {
+	return wb.intercept(ctx, wb.operation("Delete"), "", func(ctx context.Context, op *Operation) error {
+		return wb.b.Delete(fileID)
+	})
+}
+
+func (wb *WrappedBucket) Find(ctx context.Context, filter interface{}, opts ...*options.GridFSFindOptions) (*WrappedCursor, error) {
+	op := wb.operation("Find")
+	op.Filter, op.Options = filter, opts
+
+	var wcur *WrappedCursor
+	err := wb.intercept(ctx, op, "", func(ctx context.Context, op *Operation) error {
+		cur, err := wb.b.Find(op.Filter, opts...)
+		if err != nil {
+			return err
+		}
+		wcur = wb.cfg.cursorTracker.wrapCursor(cur, wb.namespace()+".files")
+		op.Result = wcur
+		return nil
+	})
+	return wcur, err
+}
+
+func (wb *WrappedBucket) Rename(ctx context.Context, fileID interface{}, newFilename string) error {
+	return wb.intercept(ctx, wb.operation("Rename"), newFilename, func(ctx context.Context, op *Operation) error {
+		return wb.b.Rename(fileID, newFilename)
+	})
+}
+
+func (wb *WrappedBucket) Bucket() *gridfs.Bucket { return wb.b }
+
+func (wb *WrappedBucket) namespace() string { return wb.database + "." + wb.name }
+
+func (wb *WrappedBucket) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "Bucket." + method, Database: wb.database, Collection: wb.name}
+}
+
+// intercept runs op through the interceptors, labeling its span with the
+// bucket and, if not empty, the name of the file.
+func (wb *WrappedBucket) intercept(ctx context.Context, op *Operation, filename string, invoke Invoker) error {
+	return wb.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		if !isUninstrumented(ctx) {
+			wb.annotate(trace.FromContext(ctx), filename)
+		}
+		return invoke(ctx, op)
+	})
+}
+
+// streamSpan starts the span of an open stream, named after kind.
+func (wb *WrappedBucket) streamSpan(ctx context.Context, kind, filename string) (context.Context, *spanWithMetrics) {
+	ctx, span := roundtripTrackingSpan(ctx, methodPrefix+"Bucket."+kind)
+	wb.annotate(span.span, filename)
+	return ctx, span
+}
+
+func (wb *WrappedBucket) annotate(span *trace.Span, filename string) {
+	span.AddAttributes(trace.StringAttribute("mongo.gridfs.bucket", wb.namespace()))
+	if filename != "" {
+		span.AddAttributes(trace.StringAttribute("mongo.gridfs.filename", filename))
+	}
+}
+
+// WrappedUploadStream is returned by WrappedBucket.OpenUploadStream. Its
+// Bucket.UploadStream span lasts until the stream is closed or aborted.
+type WrappedUploadStream struct {
+	*gridfs.UploadStream
+
+	ctx       context.Context
+	span      *spanWithMetrics
+	chunkSize int32
+	n         int64
+	// ended is set once Close or Abort has ended the span; later calls
+	// are handed to the driver without being recorded again.
+	ended   bool
+	aborted bool
+}
+
+func (wus *WrappedUploadStream) Write(p []byte) (int, error) {
+	n, err := wus.UploadStream.Write(p)
+	wus.n += int64(n)
+	if err != nil && !wus.ended {
+		wus.span.setError(err)
+	}
+	return n, err
+}
+
+// Close completes the upload. It is a no-op after Abort, so that it can be
+// deferred right after opening the stream.
+func (wus *WrappedUploadStream) Close() error {
+	if wus.aborted {
+		return nil
+	}
+	if wus.ended {
+		return wus.UploadStream.Close()
+	}
+	wus.ended = true
+
+	err := wus.UploadStream.Close()
+	if err != nil {
+		wus.span.setError(err)
+	}
+	recordTransfer(wus.ctx, wus.span.span, wus.span.method, wus.n, wus.chunkSize)
+	wus.span.end(wus.ctx)
+	return err
+}
+
+func (wus *WrappedUploadStream) Abort() error {
+	if wus.ended {
+		return wus.UploadStream.Abort()
+	}
+	wus.ended, wus.aborted = true, true
+
+	err := wus.UploadStream.Abort()
+	if err != nil {
+		wus.span.setError(err)
+	}
+	wus.span.span.Annotate(nil, "Upload aborted")
+	wus.span.end(wus.ctx)
+	return err
+}
+
+// WrappedDownloadStream is returned by WrappedBucket.OpenDownloadStream. Its
+// Bucket.DownloadStream span lasts until the stream is closed.
+type WrappedDownloadStream struct {
+	*gridfs.DownloadStream
+
+	ctx       context.Context
+	span      *spanWithMetrics
+	chunkSize int32
+	n         int64
+	ended     bool
+}
+
+func (wds *WrappedDownloadStream) Read(p []byte) (int, error) {
+	n, err := wds.DownloadStream.Read(p)
+	wds.n += int64(n)
+	if err != nil && err != io.EOF && !wds.ended {
+		wds.span.setError(err)
+	}
+	return n, err
+}
+
+func (wds *WrappedDownloadStream) Close() error {
+	if wds.ended {
+		return wds.DownloadStream.Close()
+	}
+	wds.ended = true
+
+	err := wds.DownloadStream.Close()
+	if err != nil {
+		wds.span.setError(err)
+	}
+	recordTransfer(wds.ctx, wds.span.span, wds.span.method, wds.n, wds.chunkSize)
+	wds.span.end(wds.ctx)
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+func uploadChunkSize(bucketChunkSize int32, opts []*options.UploadOptions) int32 {
+	chunkSize := bucketChunkSize
+	for _, opt := range opts {
+		if opt != nil && opt.ChunkSizeBytes != nil {
+			chunkSize = *opt.ChunkSizeBytes
+		}
+	}
+	return chunkSize
+}
+
+// recordTransfer records the bytes moved by a GridFS operation and the
+// number of chunks they span. For downloads the chunk size of the bucket is
+// assumed, which is only an estimate for files uploaded with another one.
+func recordTransfer(ctx context.Context, span *trace.Span, method string, n int64, chunkSize int32) {
+	var chunks int64
+	if chunkSize > 0 {
+		chunks = (n + int64(chunkSize) - 1) / int64(chunkSize)
+	}
+	span.AddAttributes(
+		trace.Int64Attribute("mongo.gridfs.bytes", n),
+		trace.Int64Attribute("mongo.gridfs.chunks", chunks),
+	)
+
+	ctx, _ = tag.New(ctx, tag.Upsert(keyMethod, method))
+	stats.Record(ctx, mGridFSBytes.M(n), mGridFSChunks.M(chunks))
+}
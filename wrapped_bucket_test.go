@@ -0,0 +1,139 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/stats/view"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestBucketStreams(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	bucket, err := mongowrapper.NewBucket(client.Database("db"), options.GridFSBucket().SetChunkSizeBytes(4))
+	if err != nil {
+		t.Fatalf("NewBucket: %v", err)
+	}
+	bytesSent := func() int64 {
+		t.Helper()
+		rows, err := rec.Rows("mongo/client/gridfs/bytes")
+		if err != nil {
+			t.Fatalf("Rows: %v", err)
+		}
+		var sum int64
+		for _, row := range rows {
+			sum += int64(row.Data.(*view.SumData).Value)
+		}
+		return sum
+	}
+
+	// Close after Abort is a no-op.
+	aborted, err := bucket.OpenUploadStream(ctx, "aborted.txt")
+	if err != nil {
+		t.Fatalf("OpenUploadStream: %v", err)
+	}
+	if _, err := aborted.Write([]byte("never")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := aborted.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if err := aborted.Close(); err != nil {
+		t.Errorf("Close after Abort: got %v, want nil", err)
+	}
+	if n := len(rec.SpansNamed("Bucket.UploadStream")); n != 1 {
+		t.Errorf("UploadStream spans: got %d, want 1", n)
+	}
+	if n := bytesSent(); n != 0 {
+		t.Errorf("bytes recorded for an aborted upload: got %d, want 0", n)
+	}
+
+	// A second Close fails as in the driver, without being recorded.
+	us, err := bucket.OpenUploadStream(ctx, "a.txt")
+	if err != nil {
+		t.Fatalf("OpenUploadStream: %v", err)
+	}
+	if _, err := us.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := us.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := us.Close(); err != gridfs.ErrStreamClosed {
+		t.Errorf("second Close: got %v, want ErrStreamClosed", err)
+	}
+	if err := us.Abort(); err != gridfs.ErrStreamClosed {
+		t.Errorf("Abort after Close: got %v, want ErrStreamClosed", err)
+	}
+	rec.AssertSpan(t, "Bucket.UploadStream", map[string]interface{}{
+		"mongo.gridfs.filename": "a.txt",
+		"mongo.gridfs.bytes":    int64(5),
+		"mongo.gridfs.chunks":   int64(2),
+	}, 0)
+	if n := bytesSent(); n != 5 {
+		t.Errorf("bytes recorded: got %d, want 5", n)
+	}
+
+	ds, err := bucket.OpenDownloadStream(ctx, us.FileID)
+	if err != nil {
+		t.Fatalf("OpenDownloadStream: %v", err)
+	}
+	if b, err := ioutil.ReadAll(ds); err != nil || string(b) != "hello" {
+		t.Fatalf("ReadAll: got %q, %v", b, err)
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := ds.Close(); err != gridfs.ErrStreamClosed {
+		t.Errorf("second Close: got %v, want ErrStreamClosed", err)
+	}
+	if n := len(rec.SpansNamed("Bucket.DownloadStream")); n != 1 {
+		t.Errorf("DownloadStream spans: got %d, want 1", n)
+	}
+	if n := bytesSent(); n != 10 {
+		t.Errorf("bytes recorded after the download: got %d, want 10", n)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WrappedChangeStream is the change stream returned by the WatchWrapped
+// methods. It behaves like the embedded *mongo.ChangeStream and runs every
+// wait for a change, by Next and TryNext, through the interceptors as a
+// ChangeStream.Next or ChangeStream.TryNext operation.
+type WrappedChangeStream struct {
+	*mongo.ChangeStream
+
+	cfg        *config
+	database   string
+	collection string
+	err        error
+}
+
+var _ ChangeStream = (*WrappedChangeStream)(nil)
+
+func (wcs *WrappedChangeStream) Next(ctx context.Context) bool {
+	return wcs.next(ctx, "Next", wcs.ChangeStream.Next)
+}
+
+func (wcs *WrappedChangeStream) TryNext(ctx context.Context) bool {
+	return wcs.next(ctx, "TryNext", wcs.ChangeStream.TryNext)
+}
+
+// Err returns the error of the stream, or the one an interceptor failed
+// Next or TryNext with.
+func (wcs *WrappedChangeStream) Err() error {
+	if wcs.err != nil {
+		return wcs.err
+	}
+	return wcs.ChangeStream.Err()
+}
+
+func (wcs *WrappedChangeStream) next(ctx context.Context, method string, next func(context.Context) bool) bool {
+	if wcs.err != nil {
+		return false
+	}
+	op := &Operation{Method: methodPrefix + "ChangeStream." + method, Database: wcs.database, Collection: wcs.collection}
+
+	var ok, invoked bool
+	err := wcs.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		invoked = true
+		ok = next(ctx)
+		op.Result = ok
+		return wcs.ChangeStream.Err()
+	})
+	if err != nil && (!invoked || ok) {
+		// An interceptor failed the wait, rather than the stream.
+		wcs.err, ok = err, false
+	}
+	return ok
+}
+
+// wrapChangeStream turns the result of a Watch method into the one of
+// WatchWrapped, which must not return a non-nil ChangeStream holding a nil
+// pointer.
+func (cfg *config) wrapChangeStream(cs *mongo.ChangeStream, err error, database, collection string) (ChangeStream, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &WrappedChangeStream{ChangeStream: cs, cfg: cfg, database: database, collection: collection}, nil
+}
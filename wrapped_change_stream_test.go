@@ -0,0 +1,129 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestWatchWrapped(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	errPaused := errors.New("paused")
+	var paused bool
+	client.AddInterceptors(func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		if paused && op.ShortMethod() == "ChangeStream.Next" {
+			return errPaused
+		}
+		return invoke(ctx, op)
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	if _, err := srv.Collection("db", "a").InsertMany(ctx, []interface{}{bson.M{"_id": 1}, bson.M{"_id": 2}}); err != nil {
+		t.Fatalf("InsertMany: %v", err)
+	}
+	if _, err := srv.Collection("other", "b").InsertOne(ctx, bson.M{"_id": 3}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	events := func(cs mongowrapper.ChangeStream) (ids []int32) {
+		t.Helper()
+		for cs.TryNext(ctx) {
+			var ev struct {
+				DocumentKey struct {
+					ID int32 `bson:"_id"`
+				} `bson:"documentKey"`
+			}
+			if err := cs.Decode(&ev); err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			ids = append(ids, ev.DocumentKey.ID)
+		}
+		if err := cs.Err(); err != nil {
+			t.Fatalf("TryNext: %v", err)
+		}
+		return ids
+	}
+
+	cs, err := client.Database("db").Collection("a").WatchWrapped(ctx, mongo.Pipeline{})
+	if err != nil {
+		t.Fatalf("Collection.WatchWrapped: %v", err)
+	}
+	defer cs.Close(ctx)
+	if ids := events(cs); len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("collection stream: got %v, want [1 2]", ids)
+	}
+	if got := len(rec.SpansNamed("ChangeStream.TryNext")); got != 3 {
+		t.Errorf("ChangeStream.TryNext spans: got %d, want 3", got)
+	}
+	rec.AssertSpan(t, "ChangeStream.TryNext", nil, 0)
+
+	all, err := client.WatchWrapped(ctx, mongo.Pipeline{})
+	if err != nil {
+		t.Fatalf("Client.WatchWrapped: %v", err)
+	}
+	defer all.Close(ctx)
+	if ids := events(all); len(ids) != 3 {
+		t.Errorf("cluster stream: got %v, want 3 events", ids)
+	}
+
+	db, err := client.Database("db").WatchWrapped(ctx, mongo.Pipeline{})
+	if err != nil {
+		t.Fatalf("Database.WatchWrapped: %v", err)
+	}
+	defer db.Close(ctx)
+	if !db.Next(ctx) {
+		t.Fatalf("Next: %v", db.Err())
+	}
+	rec.AssertSpan(t, "ChangeStream.Next", nil, 0)
+	if _, ok := db.(*mongowrapper.WrappedChangeStream); !ok {
+		t.Errorf("Database.WatchWrapped: got %T, want a *WrappedChangeStream", db)
+	}
+
+	paused = true
+	if db.Next(ctx) || db.Err() != errPaused {
+		t.Errorf("Next failed by an interceptor: got %v, want %v", db.Err(), errPaused)
+	}
+}
@@ -20,10 +20,23 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/trace"
 )
 
 type WrappedClient struct {
-	cc *mongo.Client
+	cc  *mongo.Client
+	cfg *config
+}
+
+// config holds the optional instrumentation installed on a WrappedClient.
+// It is shared by everything derived from the client and, like the setters
+// that fill it, must not be modified once the client is in use.
+type config struct {
+	sessionTracker *SessionTracker
+	cursorTracker  *CursorTracker
+	faultInjector  *FaultInjector
+	interceptors   []Interceptor
 }
 
 func NewClient(opts ...*options.ClientOptions) (*WrappedClient, error) {
@@ -31,18 +44,37 @@ func NewClient(opts ...*options.ClientOptions) (*WrappedClient, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &WrappedClient{cc: client}, nil
+	return &WrappedClient{cc: client, cfg: new(config)}, nil
 }
 
-func (wc *WrappedClient) Connect(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Client.Connect")
-	defer span.end(ctx)
+// SetSessionTracker makes the client record every session it starts in st
+// until the session is ended. It must be called before the client is used.
+func (wc *WrappedClient) SetSessionTracker(st *SessionTracker) {
+	wc.cfg.sessionTracker = st
+}
 
-	err := wc.cc.Connect(ctx)
-	if err != nil {
-		span.setError(err)
-	}
-	return err
+// SetCursorTracker makes the collections of the client record every cursor
+// returned by FindWrapped and AggregateWrapped in ct until it is closed or
+// exhausted. It must be called before the client is used.
+func (wc *WrappedClient) SetCursorTracker(ct *CursorTracker) {
+	wc.cfg.cursorTracker = ct
+}
+
+// SetFaultInjector makes the collections of the client inject the faults
+// of fi into their operations. It must be called before the client is used
+// and is meant for tests only.
+func (wc *WrappedClient) SetFaultInjector(fi *FaultInjector) {
+	wc.cfg.faultInjector = fi
+}
+
+func (wc *WrappedClient) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "Client." + method}
+}
+
+func (wc *WrappedClient) Connect(ctx context.Context) error {
+	return wc.cfg.intercept(ctx, wc.operation("Connect"), func(ctx context.Context, op *Operation) error {
+		return wc.cc.Connect(ctx)
+	})
 }
 
 func (wc *WrappedClient) Database(name string, opts ...*options.DatabaseOptions) *WrappedDatabase {
@@ -50,67 +82,147 @@ func (wc *WrappedClient) Database(name string, opts ...*options.DatabaseOptions)
 	if db == nil {
 		return nil
 	}
-	return &WrappedDatabase{db: db}
+	return &WrappedDatabase{db: db, cfg: wc.cfg}
 }
 
 func (wc *WrappedClient) Disconnect(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Client.Disconnect")
-	defer span.end(ctx)
-
-	err := wc.cc.Disconnect(ctx)
-	if err != nil {
-		span.setError(err)
-	}
-	return err
+	return wc.cfg.intercept(ctx, wc.operation("Disconnect"), func(ctx context.Context, op *Operation) error {
+		return wc.cc.Disconnect(ctx)
+	})
 }
 
 func (wc *WrappedClient) ListDatabaseNames(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) ([]string, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Client.ListDatabaseNames")
-	defer span.end(ctx)
-
-	dbs, err := wc.cc.ListDatabaseNames(ctx, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("ListDatabaseNames")
+	op.Filter, op.Options = filter, opts
+
+	var dbs []string
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		dbs, err = wc.cc.ListDatabaseNames(ctx, op.Filter, opts...)
+		op.Result = dbs
+		return err
+	})
 	return dbs, err
 }
 
 func (wc *WrappedClient) ListDatabases(ctx context.Context, filter interface{}, opts ...*options.ListDatabasesOptions) (mongo.ListDatabasesResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Client.ListDatabases")
-	defer span.end(ctx)
-
-	dbr, err := wc.cc.ListDatabases(ctx, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("ListDatabases")
+	op.Filter, op.Options = filter, opts
+
+	var dbr mongo.ListDatabasesResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		dbr, err = wc.cc.ListDatabases(ctx, op.Filter, opts...)
+		op.Result = dbr
+		return err
+	})
 	return dbr, err
 }
 
+// NumberSessionsInProgress returns the number of sessions in progress on the
+// client and records it in the sessions/in_progress view. The view is also
+// updated whenever a session is started or ended through the wrapper.
+func (wc *WrappedClient) NumberSessionsInProgress() int {
+	n := wc.cc.NumberSessionsInProgress()
+	stats.Record(context.Background(), mSessionsInProgress.M(int64(n)))
+	return n
+}
+
 func (wc *WrappedClient) Ping(ctx context.Context, rp *readpref.ReadPref) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Client.Ping")
-	defer span.end(ctx)
+	return wc.cfg.intercept(ctx, wc.operation("Ping"), func(ctx context.Context, op *Operation) error {
+		return wc.cc.Ping(ctx, rp)
+	})
+}
 
-	err := wc.cc.Ping(ctx, rp)
+func (wc *WrappedClient) StartSession(opts ...*options.SessionOptions) (mongo.Session, error) {
+	ws, err := wc.StartSessionWrapped(opts...)
 	if err != nil {
-		span.setError(err)
+		return nil, err
 	}
-	return err
+	return ws, nil
 }
 
-func (wc *WrappedClient) StartSession(opts ...*options.SessionOptions) (mongo.Session, error) {
+// StartSessionWrapped is like StartSession but returns the concrete
+// *WrappedSession, so that its additional methods are reachable without a
+// type assertion.
+func (wc *WrappedClient) StartSessionWrapped(opts ...*options.SessionOptions) (*WrappedSession, error) {
 	ss, err := wc.cc.StartSession(opts...)
 	if err != nil {
 		return nil, err
 	}
-	return &WrappedSession{Session: ss}, nil
+	return wc.wrapSession(ss, nil), nil
+}
+
+func (wc *WrappedClient) wrapSession(ss mongo.Session, ctx context.Context) *WrappedSession {
+	ws := &WrappedSession{Session: ss, ctx: ctx, wc: wc}
+	if st := wc.cfg.sessionTracker; st != nil {
+		ws.tracker = st
+		st.track(ws)
+	}
+	if wc.cc != nil {
+		wc.NumberSessionsInProgress()
+	}
+	return ws
+}
+
+// WithTransaction starts a session, runs fn in a transaction on it with
+// WrappedSession.WithTransaction and ends the session.
+func (wc *WrappedClient) WithTransaction(ctx context.Context, fn func(mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	var res interface{}
+	err := wc.cfg.intercept(ctx, wc.operation("WithTransaction"), func(ctx context.Context, op *Operation) error {
+		ss, err := wc.StartSession()
+		if err != nil {
+			return err
+		}
+		defer ss.EndSession(ctx)
+
+		res, err = ss.WithTransaction(ctx, fn, opts...)
+		op.Result = res
+		return err
+	})
+	return res, err
 }
 
 func (wc *WrappedClient) UseSession(ctx context.Context, fn func(mongo.SessionContext) error) error {
-	return wc.cc.UseSession(ctx, fn)
+	return wc.useSession(ctx, "UseSession", options.Session(), fn)
 }
 
 func (wc *WrappedClient) UseSessionWithOptions(ctx context.Context, opts *options.SessionOptions, fn func(mongo.SessionContext) error) error {
-	return wc.cc.UseSessionWithOptions(ctx, opts, fn)
+	return wc.useSession(ctx, "UseSessionWithOptions", opts, fn)
+}
+
+// useSession runs fn through the interceptors with a SessionContext whose
+// session is a WrappedSession, ending the session when fn returns.
+func (wc *WrappedClient) useSession(ctx context.Context, method string, opts *options.SessionOptions, fn func(mongo.SessionContext) error) error {
+	return wc.cfg.intercept(ctx, wc.operation(method), func(ctx context.Context, op *Operation) error {
+		ss, err := wc.cc.StartSession(opts)
+		if err != nil {
+			return err
+		}
+		ws := wc.wrapSession(ss, ctx)
+		defer ws.EndSession(ctx)
+		trace.FromContext(ctx).AddAttributes(trace.StringAttribute("mongo.session_id", ws.ID()))
+
+		return fn(ws.sessionContext(ctx))
+	})
+}
+
+func (wc *WrappedClient) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	op := wc.operation("Watch")
+	op.Pipeline, op.Options = pipeline, opts
+
+	var cs *mongo.ChangeStream
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		cs, err = wc.cc.Watch(ctx, op.Pipeline, opts...)
+		op.Result = cs
+		return err
+	})
+	return cs, err
+}
+
+// WatchWrapped is like Watch but returns a WrappedChangeStream, whose Next
+// and TryNext are traced.
+func (wc *WrappedClient) WatchWrapped(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error) {
+	cs, err := wc.Watch(ctx, pipeline, opts...)
+	return wc.cfg.wrapChangeStream(cs, err, "", "")
 }
 
 func (wc *WrappedClient) Client() *mongo.Client { return wc.cc }
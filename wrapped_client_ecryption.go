@@ -24,7 +24,8 @@ import (
 )
 
 type WrappedClientEncryption struct {
-	cc *mongo.ClientEncryption
+	cc  *mongo.ClientEncryption
+	cfg *config
 }
 
 func (wc *WrappedClient) NewClientEncryption(opts ...*options.ClientEncryptionOptions) (*WrappedClientEncryption, error) {
@@ -32,49 +33,51 @@ func (wc *WrappedClient) NewClientEncryption(opts ...*options.ClientEncryptionOp
 	if err != nil {
 		return nil, err
 	}
-	return &WrappedClientEncryption{cc: client}, nil
+	return &WrappedClientEncryption{cc: client, cfg: wc.cfg}, nil
+}
+
+func (wce *WrappedClientEncryption) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "ClientEncryption." + method}
 }
 
 func (wce *WrappedClientEncryption) CreateDataKey(ctx context.Context, kmsProvider string, opts ...*options.DataKeyOptions) (primitive.Binary, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.ClientEncryption.CreateDataKey")
-	defer span.end(ctx)
+	op := wce.operation("CreateDataKey")
+	op.Options = opts
 
-	id, err := wce.cc.CreateDataKey(ctx, kmsProvider, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	var id primitive.Binary
+	err := wce.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		id, err = wce.cc.CreateDataKey(ctx, kmsProvider, opts...)
+		op.Result = id
+		return err
+	})
 	return id, err
 }
 
 func (wce *WrappedClientEncryption) Encrypt(ctx context.Context, val bson.RawValue, opts ...*options.EncryptOptions) (primitive.Binary, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.ClientEncryption.Encrypt")
-	defer span.end(ctx)
+	op := wce.operation("Encrypt")
+	op.Options = opts
 
-	value, err := wce.cc.Encrypt(ctx, val, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	var value primitive.Binary
+	err := wce.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		value, err = wce.cc.Encrypt(ctx, val, opts...)
+		op.Result = value
+		return err
+	})
 	return value, err
 }
 
 func (wce *WrappedClientEncryption) Decrypt(ctx context.Context, val primitive.Binary) (bson.RawValue, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.ClientEncryption.Decrypt")
-	defer span.end(ctx)
-
-	value, err := wce.cc.Decrypt(ctx, val)
-	if err != nil {
-		span.setError(err)
-	}
+	var value bson.RawValue
+	err := wce.cfg.intercept(ctx, wce.operation("Decrypt"), func(ctx context.Context, op *Operation) (err error) {
+		value, err = wce.cc.Decrypt(ctx, val)
+		op.Result = value
+		return err
+	})
 	return value, err
 }
 
 func (wce *WrappedClientEncryption) Close(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.ClientEncryption.Close")
-	defer span.end(ctx)
-
-	err := wce.cc.Close(ctx)
-	if err != nil {
-		span.setError(err)
-	}
-	return err
+	return wce.cfg.intercept(ctx, wce.operation("Close"), func(ctx context.Context, op *Operation) error {
+		return wce.cc.Close(ctx)
+	})
 }
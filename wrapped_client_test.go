@@ -0,0 +1,84 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestWrappedHandles(t *testing.T) {
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	var calls []string
+	client.AddInterceptors(func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		calls = append(calls, op.ShortMethod()+" "+op.Namespace())
+		return invoke(ctx, op)
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	calls = nil
+
+	coll := client.Database("db").Collection("c")
+	clone, err := coll.CloneWrapped(options.Collection().SetWriteConcern(writeconcern.New(writeconcern.W(1))))
+	if err != nil {
+		t.Fatalf("CloneWrapped: %v", err)
+	}
+	if _, err := clone.InsertOne(ctx, bson.M{"_id": 1}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+	if _, err := coll.DatabaseWrapped().Collection("c").CountDocuments(ctx, bson.M{}); err != nil {
+		t.Fatalf("CountDocuments: %v", err)
+	}
+	if coll.Database().Name() != "db" {
+		t.Errorf("Database: got %q, want the raw database db", coll.Database().Name())
+	}
+
+	ws, err := client.StartSessionWrapped()
+	if err != nil {
+		t.Fatalf("StartSessionWrapped: %v", err)
+	}
+	if ws.ClientWrapped() != client {
+		t.Errorf("WrappedClient: got another client than the one that started the session")
+	}
+	ws.EndSession(ctx)
+
+	want := []string{"Collection.InsertOne db.c", "Collection.CountDocuments db.c", "Session.EndSession "}
+	if strings.Join(calls, ",") != strings.Join(want, ",") {
+		t.Errorf("interceptor calls: got %q, want %q", calls, want)
+	}
+}
@@ -16,6 +16,7 @@ package mongowrapper
 
 import (
 	"context"
+	"fmt"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
@@ -23,27 +24,69 @@ import (
 
 type WrappedCollection struct {
 	coll *mongo.Collection
+	b    CollectionBackend
+	db   string
+	cfg  *config
 }
 
-func (wc *WrappedCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.Aggregate")
-	defer span.end(ctx)
+// operation returns the descriptor of a call to the Collection method
+// named method.
+func (wc *WrappedCollection) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "Collection." + method, Database: wc.db, Collection: wc.b.Name()}
+}
 
-	cur, err := wc.coll.Aggregate(ctx, pipeline, opts...)
-	if err != nil {
-		span.setError(err)
+// withoutInterceptors returns a copy of wc whose operations skip the
+// interceptors added to the client, for the wrapper's own bookkeeping
+// writes, which are not made on behalf of a caller.
+func (wc *WrappedCollection) withoutInterceptors() *WrappedCollection {
+	bare := *wc
+	bare.cfg = new(config)
+	if wc.cfg != nil {
+		*bare.cfg = *wc.cfg
+		bare.cfg.interceptors = nil
 	}
-	return cur, err
+	return &bare
 }
 
-func (wc *WrappedCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.BulkWrite")
-	defer span.end(ctx)
+func (wc *WrappedCollection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	cur, err := wc.aggregate(ctx, pipeline, opts, nil)
+	return driverCursor("Aggregate", cur, err)
+}
 
-	bwres, err := wc.coll.BulkWrite(ctx, models, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+// AggregateWrapped is like Aggregate but returns the cursor wrapped, so
+// that a CursorTracker follows it, and works with backends that do not
+// return driver cursors.
+func (wc *WrappedCollection) AggregateWrapped(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error) {
+	return wrappedCursor(wc.aggregate(ctx, pipeline, opts, wc.cfg.cursorTracker))
+}
+
+func (wc *WrappedCollection) aggregate(ctx context.Context, pipeline interface{}, opts []*options.AggregateOptions, ct *CursorTracker) (*WrappedCursor, error) {
+	op := wc.operation("Aggregate")
+	op.Pipeline, op.Options = pipeline, opts
+
+	var wcur *WrappedCursor
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		cur, err := wc.b.Aggregate(ctx, op.Pipeline, opts...)
+		if err != nil {
+			return err
+		}
+		wcur = ct.wrapCursor(cur, wc.namespace())
+		op.Result = wcur
+		return nil
+	})
+	return wcur, err
+}
+
+func (wc *WrappedCollection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (*mongo.BulkWriteResult, error) {
+	op := wc.operation("BulkWrite")
+	op.Models, op.Options = models, opts
+
+	var bwres *mongo.BulkWriteResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		bwres, err = wc.b.BulkWrite(ctx, op.Models, opts...)
+		op.Result = bwres
+		return err
+	})
 	return bwres, err
 }
 
@@ -51,193 +94,345 @@ func (wc *WrappedCollection) Clone(opts ...*options.CollectionOptions) (*mongo.C
 	return wc.coll.Clone(opts...)
 }
 
-func (wc *WrappedCollection) Count(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.Count")
-	defer span.end(ctx)
-	count, err := wc.coll.CountDocuments(ctx, filter, opts...)
+// CloneWrapped is like Clone but returns the copy wrapped, with the same
+// instrumentation as wc.
+func (wc *WrappedCollection) CloneWrapped(opts ...*options.CollectionOptions) (*WrappedCollection, error) {
+	coll, err := wc.coll.Clone(opts...)
 	if err != nil {
-		span.setError(err)
+		return nil, err
 	}
-	return count, err
+	return newDriverCollection(coll, wc.cfg), nil
+}
+
+func (wc *WrappedCollection) Count(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
+	return wc.countDocuments(ctx, "Count", filter, opts)
 }
 
 func (wc *WrappedCollection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (int64, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.CountDocuments")
-	defer span.end(ctx)
+	return wc.countDocuments(ctx, "CountDocuments", filter, opts)
+}
 
-	count, err := wc.coll.CountDocuments(ctx, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+func (wc *WrappedCollection) countDocuments(ctx context.Context, method string, filter interface{}, opts []*options.CountOptions) (int64, error) {
+	op := wc.operation(method)
+	op.Filter, op.Options = filter, opts
+
+	var count int64
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		count, err = wc.b.CountDocuments(ctx, op.Filter, opts...)
+		op.Result = count
+		return err
+	})
 	return count, err
 }
 
 func (wc *WrappedCollection) Database() *mongo.Database { return wc.coll.Database() }
 
-func (wc *WrappedCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.DeleteMany")
-	defer span.end(ctx)
+// DatabaseWrapped is like Database but returns the database wrapped, with
+// the same instrumentation as wc.
+func (wc *WrappedCollection) DatabaseWrapped() *WrappedDatabase {
+	return &WrappedDatabase{db: wc.coll.Database(), cfg: wc.cfg}
+}
 
-	dmres, err := wc.coll.DeleteMany(ctx, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+func (wc *WrappedCollection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
+	op := wc.operation("DeleteMany")
+	op.Filter, op.Options = filter, opts
+
+	var dmres *mongo.DeleteResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		dmres, err = wc.b.DeleteMany(ctx, op.Filter, opts...)
+		op.Result = dmres
+		return err
+	})
 	return dmres, err
 }
 
 func (wc *WrappedCollection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (*mongo.DeleteResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.DeleteOne")
-	defer span.end(ctx)
-
-	dor, err := wc.coll.DeleteOne(ctx, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("DeleteOne")
+	op.Filter, op.Options = filter, opts
+
+	var dor *mongo.DeleteResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		dor, err = wc.b.DeleteOne(ctx, op.Filter, opts...)
+		op.Result = dor
+		return err
+	})
 	return dor, err
 }
 
 func (wc *WrappedCollection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) ([]interface{}, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.Distinct")
-	defer span.end(ctx)
-
-	distinct, err := wc.coll.Distinct(ctx, fieldName, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("Distinct")
+	op.Filter, op.Options = filter, opts
+
+	var distinct []interface{}
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		distinct, err = wc.b.Distinct(ctx, fieldName, op.Filter, opts...)
+		op.Result = distinct
+		return err
+	})
 	return distinct, err
 }
 
 func (wc *WrappedCollection) Drop(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.Drop")
-	defer span.end(ctx)
-
-	err := wc.coll.Drop(ctx)
-	if err != nil {
-		span.setError(err)
-	}
-	return err
+	return wc.cfg.intercept(ctx, wc.operation("Drop"), func(ctx context.Context, op *Operation) error {
+		return wc.b.Drop(ctx)
+	})
 }
 
 func (wc *WrappedCollection) EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (int64, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.EstimatedDocumentCount")
-	defer span.end(ctx)
-
-	count, err := wc.coll.EstimatedDocumentCount(ctx, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("EstimatedDocumentCount")
+	op.Options = opts
+
+	var count int64
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		count, err = wc.b.EstimatedDocumentCount(ctx, opts...)
+		op.Result = count
+		return err
+	})
 	return count, err
 }
 
 func (wc *WrappedCollection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (*mongo.Cursor, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.Find")
-	defer span.end(ctx)
+	cur, err := wc.find(ctx, filter, opts, nil)
+	return driverCursor("Find", cur, err)
+}
+
+// FindWrapped is like Find but returns the cursor wrapped, so that a
+// CursorTracker follows it, and works with backends that do not return
+// driver cursors.
+func (wc *WrappedCollection) FindWrapped(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (Cursor, error) {
+	return wrappedCursor(wc.find(ctx, filter, opts, wc.cfg.cursorTracker))
+}
+
+func (wc *WrappedCollection) find(ctx context.Context, filter interface{}, opts []*options.FindOptions, ct *CursorTracker) (*WrappedCursor, error) {
+	op := wc.operation("Find")
+	op.Filter, op.Options = filter, opts
+
+	var wcur *WrappedCursor
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		cur, err := wc.b.Find(ctx, op.Filter, opts...)
+		if err != nil {
+			return err
+		}
+		wcur = ct.wrapCursor(cur, wc.namespace())
+		op.Result = wcur
+		return nil
+	})
+	return wcur, err
+}
 
-	cur, err := wc.coll.Find(ctx, filter, opts...)
+// driverCursor returns the driver cursor behind cur for the methods that
+// keep the signature of the driver. Cursors of other backends are closed.
+func driverCursor(method string, cur *WrappedCursor, err error) (*mongo.Cursor, error) {
 	if err != nil {
-		span.setError(err)
+		return nil, err
 	}
-	return cur, err
+	if cur.Cursor != nil {
+		return cur.Cursor, nil
+	}
+	cur.Close(context.Background())
+	return nil, fmt.Errorf("mongowrapper: %s: the backend does not return driver cursors, use %sWrapped", method, method)
 }
 
+// FindOne returns the driver's result. With a backend other than the
+// driver, or when an interceptor fails the call, the result is empty
+// whatever the outcome: its Err reports ErrNoDocuments and Decode fails. Use
+// FindOneWrapped to get the document or the error.
 func (wc *WrappedCollection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) *mongo.SingleResult {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.FindOne")
-	defer span.end(ctx)
+	return driverSingleResult(wc.findOne(ctx, filter, opts))
+}
+
+// FindOneWrapped is like FindOne but returns the result as a SingleResult.
+func (wc *WrappedCollection) FindOneWrapped(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) SingleResult {
+	return wc.findOne(ctx, filter, opts)
+}
+
+func (wc *WrappedCollection) findOne(ctx context.Context, filter interface{}, opts []*options.FindOneOptions) *WrappedSingleResult {
+	op := wc.operation("FindOne")
+	op.Filter, op.Options = filter, opts
 
-	return wc.coll.FindOne(ctx, filter, opts...)
+	return wc.singleResult(ctx, op, func(ctx context.Context, op *Operation) SingleResult {
+		return wc.b.FindOne(ctx, op.Filter, opts...)
+	})
 }
 
+// FindOneAndDelete returns an empty result in the same cases as FindOne; use
+// FindOneAndDeleteWrapped to get the document or the error.
 func (wc *WrappedCollection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) *mongo.SingleResult {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.FindOneAndDelete")
-	defer span.end(ctx)
+	return driverSingleResult(wc.findOneAndDelete(ctx, filter, opts))
+}
 
-	return wc.coll.FindOneAndDelete(ctx, filter, opts...)
+// FindOneAndDeleteWrapped is like FindOneAndDelete but returns the result as a SingleResult.
+func (wc *WrappedCollection) FindOneAndDeleteWrapped(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) SingleResult {
+	return wc.findOneAndDelete(ctx, filter, opts)
 }
 
+func (wc *WrappedCollection) findOneAndDelete(ctx context.Context, filter interface{}, opts []*options.FindOneAndDeleteOptions) *WrappedSingleResult {
+	op := wc.operation("FindOneAndDelete")
+	op.Filter, op.Options = filter, opts
+
+	return wc.singleResult(ctx, op, func(ctx context.Context, op *Operation) SingleResult {
+		return wc.b.FindOneAndDelete(ctx, op.Filter, opts...)
+	})
+}
+
+// FindOneAndReplace returns an empty result in the same cases as FindOne; use
+// FindOneAndReplaceWrapped to get the document or the error.
 func (wc *WrappedCollection) FindOneAndReplace(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) *mongo.SingleResult {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.FindOneAndReplace")
-	defer span.end(ctx)
+	return driverSingleResult(wc.findOneAndReplace(ctx, filter, replacement, opts))
+}
+
+// FindOneAndReplaceWrapped is like FindOneAndReplace but returns the result as a SingleResult.
+func (wc *WrappedCollection) FindOneAndReplaceWrapped(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) SingleResult {
+	return wc.findOneAndReplace(ctx, filter, replacement, opts)
+}
+
+func (wc *WrappedCollection) findOneAndReplace(ctx context.Context, filter, replacement interface{}, opts []*options.FindOneAndReplaceOptions) *WrappedSingleResult {
+	op := wc.operation("FindOneAndReplace")
+	op.Filter, op.Update, op.Options = filter, replacement, opts
 
-	return wc.coll.FindOneAndReplace(ctx, filter, replacement, opts...)
+	return wc.singleResult(ctx, op, func(ctx context.Context, op *Operation) SingleResult {
+		return wc.b.FindOneAndReplace(ctx, op.Filter, op.Update, opts...)
+	})
 }
 
+// FindOneAndUpdate returns an empty result in the same cases as FindOne; use
+// FindOneAndUpdateWrapped to get the document or the error.
 func (wc *WrappedCollection) FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) *mongo.SingleResult {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.FindOneAndUpdate")
-	defer span.end(ctx)
+	return driverSingleResult(wc.findOneAndUpdate(ctx, filter, update, opts))
+}
 
-	return wc.coll.FindOneAndUpdate(ctx, filter, update, opts...)
+// FindOneAndUpdateWrapped is like FindOneAndUpdate but returns the result as a SingleResult.
+func (wc *WrappedCollection) FindOneAndUpdateWrapped(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) SingleResult {
+	return wc.findOneAndUpdate(ctx, filter, update, opts)
 }
 
-func (wc *WrappedCollection) Indexes() mongo.IndexView { return wc.coll.Indexes() }
+func (wc *WrappedCollection) findOneAndUpdate(ctx context.Context, filter, update interface{}, opts []*options.FindOneAndUpdateOptions) *WrappedSingleResult {
+	op := wc.operation("FindOneAndUpdate")
+	op.Filter, op.Update, op.Options = filter, update, opts
 
-func (wc *WrappedCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.InsertMany")
-	defer span.end(ctx)
+	return wc.singleResult(ctx, op, func(ctx context.Context, op *Operation) SingleResult {
+		return wc.b.FindOneAndUpdate(ctx, op.Filter, op.Update, opts...)
+	})
+}
 
-	insmres, err := wc.coll.InsertMany(ctx, documents, opts...)
-	if err != nil {
-		span.setError(err)
+// singleResult runs a FindOne style operation through the interceptors. Not
+// finding a document is not treated as an error.
+func (wc *WrappedCollection) singleResult(ctx context.Context, op *Operation, call func(context.Context, *Operation) SingleResult) *WrappedSingleResult {
+	var sr SingleResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		sr = call(ctx, op)
+		op.Result = &WrappedSingleResult{sr: sr}
+		if err := sr.Err(); err != mongo.ErrNoDocuments {
+			return err
+		}
+		return nil
+	})
+	if sr == nil {
+		// An interceptor failed the operation without invoking it.
+		sr = errSingleResult{err}
 	}
+	return &WrappedSingleResult{sr: sr}
+}
+
+func (wc *WrappedCollection) Indexes() mongo.IndexView { return wc.coll.Indexes() }
+
+// IndexesWrapped is like Indexes but returns the index view wrapped, so that
+// its calls are traced and go through the interceptors.
+func (wc *WrappedCollection) IndexesWrapped() WrappedIndexView {
+	return WrappedIndexView{iv: wc.coll.Indexes(), db: wc.db, coll: wc.b.Name(), cfg: wc.cfg}
+}
+
+func (wc *WrappedCollection) InsertMany(ctx context.Context, documents []interface{}, opts ...*options.InsertManyOptions) (*mongo.InsertManyResult, error) {
+	op := wc.operation("InsertMany")
+	op.Documents, op.Options = documents, opts
+
+	var insmres *mongo.InsertManyResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		insmres, err = wc.b.InsertMany(ctx, op.Documents, opts...)
+		op.Result = insmres
+		return err
+	})
 	return insmres, err
 }
 
 func (wc *WrappedCollection) InsertOne(ctx context.Context, document interface{}, opts ...*options.InsertOneOptions) (*mongo.InsertOneResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.InsertOne")
-	defer span.end(ctx)
-
-	insores, err := wc.coll.InsertOne(ctx, document, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("InsertOne")
+	op.Documents, op.Options = []interface{}{document}, opts
+
+	var insores *mongo.InsertOneResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		insores, err = wc.b.InsertOne(ctx, op.Documents[0], opts...)
+		op.Result = insores
+		return err
+	})
 	return insores, err
 }
 
-func (wc *WrappedCollection) Name() string { return wc.coll.Name() }
+func (wc *WrappedCollection) Name() string { return wc.b.Name() }
 
-func (wc *WrappedCollection) ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.ReplaceOne")
-	defer span.end(ctx)
+func (wc *WrappedCollection) namespace() string {
+	return wc.db + "." + wc.b.Name()
+}
 
-	repres, err := wc.coll.ReplaceOne(ctx, filter, replacement, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+func (wc *WrappedCollection) ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	op := wc.operation("ReplaceOne")
+	op.Filter, op.Update, op.Options = filter, replacement, opts
+
+	var repres *mongo.UpdateResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		repres, err = wc.b.ReplaceOne(ctx, op.Filter, op.Update, opts...)
+		op.Result = repres
+		return err
+	})
 	return repres, err
 }
 
 func (wc *WrappedCollection) UpdateMany(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.UpdateMany")
-	defer span.end(ctx)
-
-	umres, err := wc.coll.UpdateMany(ctx, filter, replacement, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("UpdateMany")
+	op.Filter, op.Update, op.Options = filter, replacement, opts
+
+	var umres *mongo.UpdateResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		umres, err = wc.b.UpdateMany(ctx, op.Filter, op.Update, opts...)
+		op.Result = umres
+		return err
+	})
 	return umres, err
 }
 
 func (wc *WrappedCollection) UpdateOne(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.UpdateOne")
-	defer span.end(ctx)
-
-	uores, err := wc.coll.UpdateOne(ctx, filter, replacement, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("UpdateOne")
+	op.Filter, op.Update, op.Options = filter, replacement, opts
+
+	var uores *mongo.UpdateResult
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		uores, err = wc.b.UpdateOne(ctx, op.Filter, op.Update, opts...)
+		op.Result = uores
+		return err
+	})
 	return uores, err
 }
 
 func (wc *WrappedCollection) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Collection.Watch")
-	defer span.end(ctx)
-
-	cs, err := wc.coll.Watch(ctx, pipeline, opts...)
-	if err != nil {
-		span.setError(err)
-	}
+	op := wc.operation("Watch")
+	op.Pipeline, op.Options = pipeline, opts
+
+	var cs *mongo.ChangeStream
+	err := wc.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		cs, err = wc.b.Watch(ctx, op.Pipeline, opts...)
+		op.Result = cs
+		return err
+	})
 	return cs, err
 }
 
+// WatchWrapped is like Watch but returns a WrappedChangeStream, whose Next
+// and TryNext are traced.
+func (wc *WrappedCollection) WatchWrapped(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error) {
+	cs, err := wc.Watch(ctx, pipeline, opts...)
+	return wc.cfg.wrapChangeStream(cs, err, wc.db, wc.b.Name())
+}
+
 func (wc *WrappedCollection) Collection() *mongo.Collection {
 	return wc.coll
 }
@@ -0,0 +1,146 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// WrappedCursor is the cursor returned by WrappedCollection.FindWrapped,
+// AggregateWrapped and the other methods that open cursors. It behaves like
+// the embedded *mongo.Cursor, which is nil for cursors that do not come from
+// the driver, and lets a CursorTracker follow the cursor until it is closed
+// or exhausted.
+type WrappedCursor struct {
+	*mongo.Cursor
+
+	// Current is the document the cursor is positioned on.
+	Current bson.Raw
+
+	cur Cursor
+	tc  *trackedCursor
+
+	// onReturned is called with the number of documents handed out by Next,
+	// TryNext and All, and their size in bytes.
+	onReturned []func(n, bytes int64)
+}
+
+var _ Cursor = (*WrappedCursor)(nil)
+
+// NewCursor wraps c, typically a fake, so that it can be returned from a
+// Collection or Database implementation used in tests.
+func NewCursor(c Cursor) *WrappedCursor {
+	dc, _ := c.(*mongo.Cursor)
+	return &WrappedCursor{Cursor: dc, cur: c}
+}
+
+func (wc *WrappedCursor) ID() int64                    { return wc.cur.ID() }
+func (wc *WrappedCursor) Decode(val interface{}) error { return wc.cur.Decode(val) }
+func (wc *WrappedCursor) Err() error                   { return wc.cur.Err() }
+
+// RemainingBatchLength returns the number of documents left in the current
+// batch, or 0 for cursors that do not report it.
+func (wc *WrappedCursor) RemainingBatchLength() int {
+	if rb, ok := wc.cur.(interface{ RemainingBatchLength() int }); ok {
+		return rb.RemainingBatchLength()
+	}
+	return 0
+}
+
+func (wc *WrappedCursor) Next(ctx context.Context) bool {
+	ok := wc.cur.Next(ctx)
+	wc.touch(ok)
+	if ok {
+		wc.positioned()
+	}
+	return ok
+}
+
+func (wc *WrappedCursor) TryNext(ctx context.Context) bool {
+	ok := wc.cur.TryNext(ctx)
+	wc.touch(ok)
+	if ok {
+		wc.positioned()
+	}
+	return ok
+}
+
+// All decodes the remaining documents into results and closes the cursor.
+func (wc *WrappedCursor) All(ctx context.Context, results interface{}) error {
+	err := wc.cur.All(ctx, results)
+	wc.untrack()
+	if rv := reflect.ValueOf(results); err == nil && rv.Kind() == reflect.Ptr && rv.Elem().Kind() == reflect.Slice && len(wc.onReturned) > 0 {
+		var size int64
+		for i := 0; i < rv.Elem().Len(); i++ {
+			size += bsonSize(rv.Elem().Index(i).Interface())
+		}
+		wc.returned(int64(rv.Elem().Len()), size)
+	}
+	return err
+}
+
+func (wc *WrappedCursor) Close(ctx context.Context) error {
+	err := wc.cur.Close(ctx)
+	wc.untrack()
+	return err
+}
+
+// touch records the use of the cursor, and stops tracking it once it is
+// exhausted since it then no longer holds any server resources.
+func (wc *WrappedCursor) touch(ok bool) {
+	if wc.tc == nil {
+		return
+	}
+	if !ok && wc.cur.ID() == 0 {
+		wc.untrack()
+		return
+	}
+	wc.tc.touch()
+}
+
+// observeReturned makes fn be called with the number of documents the
+// cursor hands out as it is iterated, and their size in bytes.
+func (wc *WrappedCursor) observeReturned(fn func(n, bytes int64)) {
+	wc.onReturned = append(wc.onReturned, fn)
+}
+
+// positioned updates Current to the document the cursor moved to and
+// reports it as returned.
+func (wc *WrappedCursor) positioned() {
+	if wc.Cursor != nil {
+		wc.Current = wc.Cursor.Current
+	} else {
+		wc.Current = nil
+		wc.cur.Decode(&wc.Current)
+	}
+	wc.returned(1, int64(len(wc.Current)))
+}
+
+func (wc *WrappedCursor) returned(n, bytes int64) {
+	for _, fn := range wc.onReturned {
+		fn(n, bytes)
+	}
+}
+
+func (wc *WrappedCursor) untrack() {
+	if wc.tc == nil {
+		return
+	}
+	wc.tc.tracker.untrack(wc.tc)
+}
@@ -26,10 +26,13 @@ import (
 )
 
 type WrappedDatabase struct {
-	mu sync.Mutex
-	db *mongo.Database
+	mu  sync.Mutex
+	db  *mongo.Database
+	cfg *config
 }
 
+// Client returns the client of the database, wrapped with the same
+// instrumentation as wd.
 func (wd *WrappedDatabase) Client() *WrappedClient {
 	wd.mu.Lock()
 	defer wd.mu.Unlock()
@@ -38,7 +41,57 @@ func (wd *WrappedDatabase) Client() *WrappedClient {
 	if cc == nil {
 		return nil
 	}
-	return &WrappedClient{cc: cc}
+	return &WrappedClient{cc: cc, cfg: wd.cfg}
+}
+
+func (wd *WrappedDatabase) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "Database." + method, Database: wd.db.Name()}
+}
+
+func (wd *WrappedDatabase) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (*mongo.Cursor, error) {
+	cur, err := wd.aggregate(ctx, pipeline, opts, nil)
+	return driverCursor("Aggregate", cur, err)
+}
+
+// AggregateWrapped is like Aggregate but returns the cursor wrapped, so that
+// a CursorTracker follows it.
+func (wd *WrappedDatabase) AggregateWrapped(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (Cursor, error) {
+	return wrappedCursor(wd.aggregate(ctx, pipeline, opts, wd.cfg.cursorTracker))
+}
+
+func (wd *WrappedDatabase) aggregate(ctx context.Context, pipeline interface{}, opts []*options.AggregateOptions, ct *CursorTracker) (*WrappedCursor, error) {
+	op := wd.operation("Aggregate")
+	op.Pipeline, op.Options = pipeline, opts
+
+	return wd.cursor(ctx, op, ".$cmd.aggregate", ct, func(ctx context.Context, op *Operation) (*mongo.Cursor, error) {
+		return wd.db.Aggregate(ctx, op.Pipeline, opts...)
+	})
+}
+
+// cursor runs an operation returning a cursor through the interceptors and
+// wraps the cursor, tracking it in ct under the database name followed by
+// suffix.
+func (wd *WrappedDatabase) cursor(ctx context.Context, op *Operation, suffix string, ct *CursorTracker, call func(context.Context, *Operation) (*mongo.Cursor, error)) (*WrappedCursor, error) {
+	var wcur *WrappedCursor
+	err := wd.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		cur, err := call(ctx, op)
+		if err != nil {
+			return err
+		}
+		wcur = ct.wrapCursor(cur, wd.db.Name()+suffix)
+		op.Result = wcur
+		return nil
+	})
+	return wcur, err
+}
+
+// wrappedCursor turns the result of cursor into the one of a *Wrapped
+// method, which must not return a non-nil Cursor holding a nil pointer.
+func wrappedCursor(cur *WrappedCursor, err error) (Cursor, error) {
+	if err != nil {
+		return nil, err
+	}
+	return cur, nil
 }
 
 func (wd *WrappedDatabase) Collection(name string, opts ...*options.CollectionOptions) *WrappedCollection {
@@ -49,40 +102,120 @@ func (wd *WrappedDatabase) Collection(name string, opts ...*options.CollectionOp
 	if coll == nil {
 		return nil
 	}
-	return &WrappedCollection{coll: coll}
+	return newDriverCollection(coll, wd.cfg)
 }
 
 func (wd *WrappedDatabase) Drop(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Database.Drop")
-	defer span.end(ctx)
-
-	err := wd.db.Drop(ctx)
-	if err != nil {
-		span.setError(err)
-	}
-	return err
+	return wd.cfg.intercept(ctx, wd.operation("Drop"), func(ctx context.Context, op *Operation) error {
+		return wd.db.Drop(ctx)
+	})
 }
 
 func (wd *WrappedDatabase) ListCollections(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) (*mongo.Cursor, error) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Database.ListCollections")
-	defer span.end(ctx)
+	cur, err := wd.listCollections(ctx, filter, opts, nil)
+	return driverCursor("ListCollections", cur, err)
+}
 
-	cur, err := wd.db.ListCollections(ctx, filter, opts...)
-	if err != nil {
-		span.setError(err)
-	}
-	return cur, err
+// ListCollectionsWrapped is like ListCollections but returns the cursor
+// wrapped, so that a CursorTracker follows it.
+func (wd *WrappedDatabase) ListCollectionsWrapped(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) (Cursor, error) {
+	return wrappedCursor(wd.listCollections(ctx, filter, opts, wd.cfg.cursorTracker))
+}
+
+func (wd *WrappedDatabase) listCollections(ctx context.Context, filter interface{}, opts []*options.ListCollectionsOptions, ct *CursorTracker) (*WrappedCursor, error) {
+	op := wd.operation("ListCollections")
+	op.Filter, op.Options = filter, opts
+
+	return wd.cursor(ctx, op, ".$cmd.listCollections", ct, func(ctx context.Context, op *Operation) (*mongo.Cursor, error) {
+		return wd.db.ListCollections(ctx, op.Filter, opts...)
+	})
+}
+
+func (wd *WrappedDatabase) ListCollectionNames(ctx context.Context, filter interface{}, opts ...*options.ListCollectionsOptions) ([]string, error) {
+	op := wd.operation("ListCollectionNames")
+	op.Filter, op.Options = filter, opts
+
+	var names []string
+	err := wd.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		names, err = wd.db.ListCollectionNames(ctx, op.Filter, opts...)
+		op.Result = names
+		return err
+	})
+	return names, err
 }
 
 func (wd *WrappedDatabase) Name() string                          { return wd.db.Name() }
 func (wd *WrappedDatabase) ReadConcern() *readconcern.ReadConcern { return wd.db.ReadConcern() }
 func (wd *WrappedDatabase) ReadPreference() *readpref.ReadPref    { return wd.db.ReadPreference() }
 
+// RunCommand returns the driver's result. When an interceptor fails the
+// command, the result is empty instead, as with FindOne: use
+// RunCommandWrapped to get the error.
 func (wd *WrappedDatabase) RunCommand(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) *mongo.SingleResult {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Database.RunCommand")
-	defer span.end(ctx)
+	return driverSingleResult(wd.runCommand(ctx, runCommand, opts))
+}
+
+// RunCommandWrapped is like RunCommand but returns the result as a
+// SingleResult.
+func (wd *WrappedDatabase) RunCommandWrapped(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) SingleResult {
+	return wd.runCommand(ctx, runCommand, opts)
+}
+
+func (wd *WrappedDatabase) runCommand(ctx context.Context, runCommand interface{}, opts []*options.RunCmdOptions) *WrappedSingleResult {
+	op := wd.operation("RunCommand")
+	op.Documents, op.Options = []interface{}{runCommand}, opts
+
+	var sr *mongo.SingleResult
+	err := wd.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		sr = wd.db.RunCommand(ctx, op.Documents[0], opts...)
+		op.Result = sr
+		return sr.Err()
+	})
+	if sr == nil {
+		// An interceptor failed the command without running it.
+		return NewSingleResult(errSingleResult{err})
+	}
+	return NewSingleResult(sr)
+}
+
+func (wd *WrappedDatabase) RunCommandCursor(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) (*mongo.Cursor, error) {
+	cur, err := wd.runCommandCursor(ctx, runCommand, opts, nil)
+	return driverCursor("RunCommandCursor", cur, err)
+}
+
+// RunCommandCursorWrapped is like RunCommandCursor but returns the cursor
+// wrapped, so that a CursorTracker follows it.
+func (wd *WrappedDatabase) RunCommandCursorWrapped(ctx context.Context, runCommand interface{}, opts ...*options.RunCmdOptions) (Cursor, error) {
+	return wrappedCursor(wd.runCommandCursor(ctx, runCommand, opts, wd.cfg.cursorTracker))
+}
+
+func (wd *WrappedDatabase) runCommandCursor(ctx context.Context, runCommand interface{}, opts []*options.RunCmdOptions, ct *CursorTracker) (*WrappedCursor, error) {
+	op := wd.operation("RunCommandCursor")
+	op.Documents, op.Options = []interface{}{runCommand}, opts
+
+	return wd.cursor(ctx, op, ".$cmd", ct, func(ctx context.Context, op *Operation) (*mongo.Cursor, error) {
+		return wd.db.RunCommandCursor(ctx, op.Documents[0], opts...)
+	})
+}
+
+func (wd *WrappedDatabase) Watch(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (*mongo.ChangeStream, error) {
+	op := wd.operation("Watch")
+	op.Pipeline, op.Options = pipeline, opts
+
+	var cs *mongo.ChangeStream
+	err := wd.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		cs, err = wd.db.Watch(ctx, op.Pipeline, opts...)
+		op.Result = cs
+		return err
+	})
+	return cs, err
+}
 
-	return wd.db.RunCommand(ctx, runCommand, opts...)
+// WatchWrapped is like Watch but returns a WrappedChangeStream, whose Next
+// and TryNext are traced.
+func (wd *WrappedDatabase) WatchWrapped(ctx context.Context, pipeline interface{}, opts ...*options.ChangeStreamOptions) (ChangeStream, error) {
+	cs, err := wd.Watch(ctx, pipeline, opts...)
+	return wd.cfg.wrapChangeStream(cs, err, wd.db.Name(), "")
 }
 
 func (wd *WrappedDatabase) WriteConcern() *writeconcern.WriteConcern { return wd.db.WriteConcern() }
@@ -0,0 +1,108 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/trace"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestDatabase(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	var intercepted int
+	client.AddInterceptors(func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		intercepted++
+		return invoke(ctx, op)
+	})
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	for _, name := range []string{"b", "a"} {
+		if _, err := srv.Collection("db", name).InsertOne(ctx, bson.M{"_id": 1}); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+	db := client.Database("db")
+
+	names, err := db.ListCollectionNames(ctx, bson.M{})
+	if err != nil || len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("ListCollectionNames: got %v, %v, want [a b]", names, err)
+	}
+	rec.AssertSpan(t, "Database.ListCollectionNames", nil, trace.StatusCodeOK)
+
+	cur, err := db.ListCollectionsWrapped(ctx, bson.M{"name": "b"})
+	if err != nil {
+		t.Fatalf("ListCollectionsWrapped: %v", err)
+	}
+	var colls []struct{ Name string }
+	if err := cur.All(ctx, &colls); err != nil || len(colls) != 1 || colls[0].Name != "b" {
+		t.Errorf("ListCollectionsWrapped: got %v, %v, want b", colls, err)
+	}
+
+	raw, err := db.RunCommandCursor(ctx, bson.D{{Key: "find", Value: "a"}})
+	if err != nil {
+		t.Fatalf("RunCommandCursor: %v", err)
+	}
+	if !raw.Next(ctx) || raw.Current.Lookup("_id").Int32() != 1 {
+		t.Errorf("RunCommandCursor: got no document with _id 1")
+	}
+	raw.Close(ctx)
+	rec.AssertSpan(t, "Database.RunCommandCursor", nil, trace.StatusCodeOK)
+
+	// The server has no database-level aggregation stages; the failure is
+	// traced like any other.
+	if _, err := db.Aggregate(ctx, mongo.Pipeline{{{Key: "$currentOp", Value: bson.D{}}}}); err == nil {
+		t.Errorf("Aggregate: got no error")
+	}
+	rec.AssertSpan(t, "Database.Aggregate", nil, trace.StatusCodeUnknown)
+
+	// The client of the database keeps the configuration of the wrapper.
+	before := intercepted
+	if err := db.Client().Ping(ctx, nil); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if intercepted != before+1 {
+		t.Errorf("Client: the client returned does not go through the interceptors")
+	}
+}
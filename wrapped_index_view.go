@@ -0,0 +1,171 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/trace"
+)
+
+type WrappedIndexView struct {
+	iv   mongo.IndexView
+	db   string
+	coll string
+	cfg  *config
+}
+
+func (wiv WrappedIndexView) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "IndexView." + method, Database: wiv.db, Collection: wiv.coll}
+}
+
+func (wiv WrappedIndexView) namespace() string { return wiv.db + "." + wiv.coll }
+
+func (wiv WrappedIndexView) List(ctx context.Context, opts ...*options.ListIndexesOptions) (*WrappedCursor, error) {
+	op := wiv.operation("List")
+	op.Options = opts
+
+	var wcur *WrappedCursor
+	err := wiv.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) error {
+		trace.FromContext(ctx).AddAttributes(trace.StringAttribute("mongo.namespace", wiv.namespace()))
+
+		cur, err := wiv.iv.List(ctx, opts...)
+		if err != nil {
+			return err
+		}
+		wcur = wiv.cfg.cursorTracker.wrapCursor(cur, wiv.namespace())
+		op.Result = wcur
+		return nil
+	})
+	return wcur, err
+}
+
+func (wiv WrappedIndexView) CreateOne(ctx context.Context, model mongo.IndexModel, opts ...*options.CreateIndexesOptions) (string, error) {
+	op := wiv.operation("CreateOne")
+	op.Options = opts
+
+	var name string
+	err := wiv.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		span := trace.FromContext(ctx)
+		span.AddAttributes(trace.StringAttribute("mongo.namespace", wiv.namespace()))
+		span.AddAttributes(indexModelAttributes("mongo.index", model)...)
+
+		name, err = wiv.iv.CreateOne(ctx, model, opts...)
+		op.Result = name
+		return err
+	})
+	return name, err
+}
+
+func (wiv WrappedIndexView) CreateMany(ctx context.Context, models []mongo.IndexModel, opts ...*options.CreateIndexesOptions) ([]string, error) {
+	op := wiv.operation("CreateMany")
+	op.Options = opts
+
+	var names []string
+	err := wiv.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		span := trace.FromContext(ctx)
+		span.AddAttributes(
+			trace.StringAttribute("mongo.namespace", wiv.namespace()),
+			trace.Int64Attribute("mongo.index_count", int64(len(models))),
+		)
+		for i, model := range models {
+			span.AddAttributes(indexModelAttributes(fmt.Sprintf("mongo.index.%d", i), model)...)
+		}
+
+		names, err = wiv.iv.CreateMany(ctx, models, opts...)
+		op.Result = names
+		return err
+	})
+	return names, err
+}
+
+func (wiv WrappedIndexView) DropOne(ctx context.Context, name string, opts ...*options.DropIndexesOptions) (bson.Raw, error) {
+	op := wiv.operation("DropOne")
+	op.Options = opts
+
+	var res bson.Raw
+	err := wiv.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		trace.FromContext(ctx).AddAttributes(
+			trace.StringAttribute("mongo.namespace", wiv.namespace()),
+			trace.StringAttribute("mongo.index.name", name),
+		)
+
+		res, err = wiv.iv.DropOne(ctx, name, opts...)
+		op.Result = res
+		return err
+	})
+	return res, err
+}
+
+func (wiv WrappedIndexView) DropAll(ctx context.Context, opts ...*options.DropIndexesOptions) (bson.Raw, error) {
+	op := wiv.operation("DropAll")
+	op.Options = opts
+
+	var res bson.Raw
+	err := wiv.cfg.intercept(ctx, op, func(ctx context.Context, op *Operation) (err error) {
+		trace.FromContext(ctx).AddAttributes(trace.StringAttribute("mongo.namespace", wiv.namespace()))
+
+		res, err = wiv.iv.DropAll(ctx, opts...)
+		op.Result = res
+		return err
+	})
+	return res, err
+}
+
+func (wiv WrappedIndexView) IndexView() mongo.IndexView { return wiv.iv }
+
+// indexModelAttributes describes the keys, name and main options of an index
+// as span attributes whose keys start with prefix.
+func indexModelAttributes(prefix string, model mongo.IndexModel) []trace.Attribute {
+	attrs := []trace.Attribute{trace.StringAttribute(prefix+".keys", shapeString(model.Keys))}
+
+	io := model.Options
+	if io == nil {
+		return attrs
+	}
+	if io.Name != nil {
+		attrs = append(attrs, trace.StringAttribute(prefix+".name", *io.Name))
+	}
+	if io.Unique != nil {
+		attrs = append(attrs, trace.BoolAttribute(prefix+".unique", *io.Unique))
+	}
+	if io.Sparse != nil {
+		attrs = append(attrs, trace.BoolAttribute(prefix+".sparse", *io.Sparse))
+	}
+	if io.Background != nil {
+		attrs = append(attrs, trace.BoolAttribute(prefix+".background", *io.Background))
+	}
+	if io.ExpireAfterSeconds != nil {
+		attrs = append(attrs, trace.Int64Attribute(prefix+".expire_after_seconds", int64(*io.ExpireAfterSeconds)))
+	}
+	if io.PartialFilterExpression != nil {
+		attrs = append(attrs, trace.StringAttribute(prefix+".partial_filter", redactedShape(io.PartialFilterExpression)))
+	}
+	return attrs
+}
+
+// shapeString renders a document such as index keys as extended JSON,
+// falling back to its Go representation.
+func shapeString(doc interface{}) string {
+	b, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return fmt.Sprint(doc)
+	}
+	return string(b)
+}
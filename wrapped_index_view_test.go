@@ -0,0 +1,120 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/trace"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestIndexView(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	srv, err := mongowrappertest.NewServer()
+	if err != nil {
+		t.Fatalf("NewServer: %v", err)
+	}
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := mongowrapper.NewClient(options.Client().ApplyURI(srv.URI()))
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(ctx)
+	iv := client.Database("db").Collection("c").IndexesWrapped()
+
+	name, err := iv.CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetName("email_unique").SetUnique(true).
+			SetPartialFilterExpression(bson.M{"tenant": "acme"}),
+	})
+	if err != nil || name != "email_unique" {
+		t.Fatalf("CreateOne: got %q, %v", name, err)
+	}
+	rec.AssertSpan(t, "IndexView.CreateOne", map[string]interface{}{
+		"mongo.namespace":    "db.c",
+		"mongo.index.keys":   `{"email":1}`,
+		"mongo.index.name":   "email_unique",
+		"mongo.index.unique": true,
+		// The values of the partial filter are not disclosed.
+		"mongo.index.partial_filter": `{"tenant":"?"}`,
+	}, trace.StatusCodeOK)
+
+	names, err := iv.CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "a", Value: 1}}},
+		{Keys: bson.D{{Key: "b", Value: -1}}, Options: options.Index().SetExpireAfterSeconds(60)},
+	})
+	if err != nil || len(names) != 2 || names[0] != "a_1" || names[1] != "b_-1" {
+		t.Fatalf("CreateMany: got %v, %v", names, err)
+	}
+	rec.AssertSpan(t, "IndexView.CreateMany", map[string]interface{}{
+		"mongo.index_count":                  int64(2),
+		"mongo.index.0.keys":                 `{"a":1}`,
+		"mongo.index.1.expire_after_seconds": int64(60),
+	}, trace.StatusCodeOK)
+
+	list := func() (names []string) {
+		t.Helper()
+		cur, err := iv.List(ctx)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var specs []struct{ Name string }
+		if err := cur.All(ctx, &specs); err != nil {
+			t.Fatalf("All: %v", err)
+		}
+		for _, spec := range specs {
+			names = append(names, spec.Name)
+		}
+		return names
+	}
+	if got := list(); len(got) != 4 {
+		t.Errorf("List: got %v, want 4 indexes", got)
+	}
+
+	if _, err := iv.DropOne(ctx, "a_1"); err != nil {
+		t.Fatalf("DropOne: %v", err)
+	}
+	rec.AssertSpan(t, "IndexView.DropOne", map[string]interface{}{"mongo.index.name": "a_1"}, trace.StatusCodeOK)
+	if _, err := iv.DropOne(ctx, "a_1"); err == nil {
+		t.Errorf("DropOne of a missing index: got no error")
+	}
+	if _, err := iv.DropAll(ctx); err != nil {
+		t.Fatalf("DropAll: %v", err)
+	}
+	if got := list(); len(got) != 1 || got[0] != "_id_" {
+		t.Errorf("List after DropAll: got %v, want [_id_]", got)
+	}
+	rec.AssertCalls(t, "IndexView.List", 2)
+}
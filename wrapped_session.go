@@ -16,64 +16,478 @@ package mongowrapper
 
 import (
 	"context"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
 )
 
 type WrappedSession struct {
 	mongo.Session
+
+	mu sync.Mutex
+	// txnSpan covers the transaction in progress, from StartTransaction
+	// until CommitTransaction, AbortTransaction or EndSession.
+	txnSpan *spanWithMetrics
+	txnCtx  context.Context
+
+	// ctx parents the transaction span started by StartTransaction,
+	// for sessions handed out by UseSession.
+	ctx context.Context
+
+	tracker *SessionTracker
+	wc      *WrappedClient
 }
 
 var _ mongo.Session = (*WrappedSession)(nil)
 
-func (ws *WrappedSession) EndSession(ctx context.Context) {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Session.EndSession")
-	defer span.end(ctx)
+func (ws *WrappedSession) operation(method string) *Operation {
+	return &Operation{Method: methodPrefix + "Session." + method}
+}
 
-	ws.Session.EndSession(ctx)
+// intercept runs op through the interceptors of the client that started the
+// session, or only the built-in ones for sessions wrapped without a client.
+func (ws *WrappedSession) intercept(ctx context.Context, op *Operation, invoke Invoker) error {
+	var cfg *config
+	if ws.wc != nil {
+		cfg = ws.wc.cfg
+	}
+	return cfg.intercept(ctx, op, invoke)
 }
 
+func (ws *WrappedSession) EndSession(ctx context.Context) {
+	ws.intercept(ctx, ws.operation("EndSession"), func(ctx context.Context, op *Operation) error {
+		ws.Session.EndSession(ctx)
+		return nil
+	})
+	// The driver aborts any transaction still in progress.
+	ws.endTransaction("aborted", nil)
+	if ws.tracker != nil {
+		ws.tracker.untrack(ws)
+	}
+	if ws.wc != nil && ws.wc.cc != nil {
+		ws.wc.NumberSessionsInProgress()
+	}
+}
+
+// StartTransaction starts a transaction whose span is parented on the
+// context of the UseSession or WithTransaction call the session was handed
+// out by, if any. Call StartTransaction on the SessionContext, or use
+// StartTransactionContext, to parent it on another span.
 func (ws *WrappedSession) StartTransaction(topts ...*options.TransactionOptions) error {
-	return ws.Session.StartTransaction(topts...)
+	ctx := ws.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, err := ws.StartTransactionContext(ctx, topts...)
+	return err
 }
 
-func (ws *WrappedSession) AbortTransaction(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Session.AbortTransaction")
-	defer span.end(ctx)
+// StartTransactionContext is like StartTransaction but the transaction span
+// is parented on the span in ctx, if any. The returned context carries the
+// transaction span and should be passed to the operations performed inside
+// the transaction so that their spans become children of it.
+func (ws *WrappedSession) StartTransactionContext(ctx context.Context, topts ...*options.TransactionOptions) (context.Context, error) {
+	txnCtx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Session.Transaction")
 
-	err := ws.Session.AbortTransaction(ctx)
-	if err != nil {
+	if err := ws.Session.StartTransaction(topts...); err != nil {
 		span.setError(err)
+		span.end(txnCtx)
+		return ctx, err
 	}
+
+	span.span.AddAttributes(
+		trace.StringAttribute("mongo.session_id", ws.ID()),
+		trace.Int64Attribute("mongo.txn_number", ws.TxnNumber()),
+	)
+
+	ws.mu.Lock()
+	ws.txnSpan, ws.txnCtx = span, txnCtx
+	ws.mu.Unlock()
+
+	return txnCtx, nil
+}
+
+// TransactionContext returns ctx with the span of the transaction in progress
+// attached, so that operations started from it are parented on the
+// transaction. If no transaction is in progress, ctx is returned unchanged.
+func (ws *WrappedSession) TransactionContext(ctx context.Context) context.Context {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.txnSpan == nil {
+		return ctx
+	}
+	return trace.NewContext(ctx, ws.txnSpan.span)
+}
+
+func (ws *WrappedSession) AbortTransaction(ctx context.Context) error {
+	err := ws.intercept(ws.TransactionContext(ctx), ws.operation("AbortTransaction"), func(ctx context.Context, op *Operation) error {
+		return ws.Session.AbortTransaction(ctx)
+	})
+	ws.endTransaction("aborted", err)
 	return err
 }
 
 func (ws *WrappedSession) CommitTransaction(ctx context.Context) error {
-	ctx, span := roundtripTrackingSpan(ctx, "go.mongodb.org/mongo-driver.Session.CommitTransaction")
-	defer span.end(ctx)
+	err := ws.commitTransaction(ctx)
+	ws.endTransaction("committed", err)
+	return err
+}
+
+// commitTransaction commits without ending the transaction span, so that
+// WithTransaction can retry the commit within the same transaction.
+func (ws *WrappedSession) commitTransaction(ctx context.Context) error {
+	return ws.intercept(ws.TransactionContext(ctx), ws.operation("CommitTransaction"), func(ctx context.Context, op *Operation) error {
+		return ws.Session.CommitTransaction(ctx)
+	})
+}
 
-	err := ws.Session.CommitTransaction(ctx)
+// endTransaction ends the transaction span, if any, recording its outcome.
+func (ws *WrappedSession) endTransaction(outcome string, err error) {
+	ws.mu.Lock()
+	span, ctx := ws.txnSpan, ws.txnCtx
+	ws.txnSpan, ws.txnCtx = nil, nil
+	ws.mu.Unlock()
+
+	if span == nil {
+		return
+	}
 	if err != nil {
+		outcome += "_failed"
 		span.setError(err)
 	}
+	latencyMs := float64(time.Since(span.startTime)) / 1e6
+	span.span.AddAttributes(
+		trace.StringAttribute("mongo.txn_outcome", outcome),
+		trace.Float64Attribute("mongo.txn_duration_ms", latencyMs),
+	)
+	span.end(ctx)
+
+	tctx, _ := tag.New(ctx, tag.Upsert(keyTxnOutcome, outcome))
+	stats.Record(tctx, mTxnLatencyMs.M(latencyMs))
+}
+
+// withTransactionTimeout mirrors the retry deadline used by the driver.
+var withTransactionTimeout = 120 * time.Second
+
+const (
+	transientTransactionError      = "TransientTransactionError"
+	unknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// WithTransaction runs fn inside a transaction, retrying it like
+// mongo.Session.WithTransaction does. Every attempt gets its own transaction
+// span, labeled with the attempt number and the reason for retrying, and the
+// callback receives a SessionContext whose session is this WrappedSession.
+func (ws *WrappedSession) WithTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	var res interface{}
+	err := ws.intercept(ctx, ws.operation("WithTransaction"), func(ctx context.Context, op *Operation) (err error) {
+		res, err = ws.withTransaction(ctx, fn, opts...)
+		op.Result = res
+		return err
+	})
+	return res, err
+}
+
+func (ws *WrappedSession) withTransaction(ctx context.Context, fn func(sessCtx mongo.SessionContext) (interface{}, error), opts ...*options.TransactionOptions) (interface{}, error) {
+	timeout := time.NewTimer(withTransactionTimeout)
+	defer timeout.Stop()
+
+	retryReason := "none"
+	for attempt := int64(1); ; attempt++ {
+		actx, _ := tag.New(ctx, tag.Upsert(keyTxnRetryReason, retryReason))
+		stats.Record(actx, mTxnAttempts.M(1))
+
+		txnCtx, err := ws.StartTransactionContext(ctx, opts...)
+		if err != nil {
+			return nil, err
+		}
+		ws.annotateAttempt(attempt, retryReason)
+
+		res, err := fn(ws.sessionContext(txnCtx))
+		if err != nil {
+			if ws.transactionRunning() {
+				_ = ws.AbortTransaction(txnCtx)
+			}
+
+			select {
+			case <-timeout.C:
+				return nil, err
+			default:
+			}
+
+			if cerr, ok := err.(mongo.CommandError); ok && cerr.HasErrorLabel(transientTransactionError) {
+				retryReason = transientTransactionError
+				continue
+			}
+			return res, err
+		}
+
+		if !ws.transactionRunning() {
+			// fn committed or aborted the transaction itself.
+			return res, nil
+		}
+
+	CommitLoop:
+		for {
+			err = ws.commitTransaction(txnCtx)
+			cerr, retryable := err.(mongo.CommandError)
+			if retryable {
+				select {
+				case <-timeout.C:
+					retryable = false
+				default:
+				}
+			}
+			if retryable && cerr.HasErrorLabel(unknownTransactionCommitResult) && !cerr.IsMaxTimeMSExpiredError() {
+				trace.FromContext(txnCtx).Annotate([]trace.Attribute{
+					trace.StringAttribute("mongo.txn_retry_reason", unknownTransactionCommitResult),
+				}, "Retrying commit")
+				continue
+			}
+
+			// The commit is not retried, so the transaction has its outcome.
+			ws.endTransaction("committed", err)
+			if retryable && cerr.HasErrorLabel(transientTransactionError) {
+				retryReason = transientTransactionError
+				break CommitLoop
+			}
+			return res, err
+		}
+	}
+}
+
+func (ws *WrappedSession) annotateAttempt(attempt int64, retryReason string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.txnSpan == nil {
+		return
+	}
+	ws.txnSpan.span.AddAttributes(
+		trace.Int64Attribute("mongo.txn_attempt", attempt),
+		trace.StringAttribute("mongo.txn_retry_reason", retryReason),
+	)
+}
+
+// transactionRunning reports whether the underlying session still has a
+// transaction that can be committed or aborted.
+func (ws *WrappedSession) transactionRunning() bool {
+	if xs, ok := ws.Session.(mongo.XSession); ok {
+		if cs := xs.ClientSession(); cs != nil {
+			return cs.TransactionRunning()
+		}
+	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.txnSpan != nil
+}
+
+// sessionContext is a mongo.SessionContext whose Session is a WrappedSession.
+// Its Context derives from a SessionContext created by the driver for the
+// underlying session, since that is what the driver looks up when running
+// operations.
+type sessionContext struct {
+	context.Context
+	mongo.Session
+}
+
+// StartTransaction starts a transaction whose span is parented on the span
+// in the SessionContext.
+func (sc *sessionContext) StartTransaction(topts ...*options.TransactionOptions) error {
+	_, err := sc.Session.(*WrappedSession).StartTransactionContext(sc.Context, topts...)
 	return err
 }
 
+type wrappedSessionKey struct{}
+
+func (ws *WrappedSession) sessionContext(ctx context.Context) mongo.SessionContext {
+	var sctx mongo.SessionContext
+	_ = mongo.WithSession(ctx, ws.Session, func(sc mongo.SessionContext) error {
+		sctx = sc
+		return nil
+	})
+	return &sessionContext{Context: context.WithValue(sctx, wrappedSessionKey{}, ws), Session: ws}
+}
+
+// sessionFromContext returns the WrappedSession that ctx was derived from by
+// UseSession or WithTransaction, or nil.
+func sessionFromContext(ctx context.Context) *WrappedSession {
+	ws, _ := ctx.Value(wrappedSessionKey{}).(*WrappedSession)
+	return ws
+}
+
+// ClientWrapped returns the client that started the session, or nil if the
+// session was not started through a WrappedClient. Client returns the
+// underlying *mongo.Client.
+func (ws *WrappedSession) ClientWrapped() *WrappedClient { return ws.wc }
+
+// ID returns the hex encoded logical session ID, or "" if the underlying
+// session does not expose it.
+func (ws *WrappedSession) ID() string {
+	xs, ok := ws.Session.(mongo.XSession)
+	if !ok {
+		return ""
+	}
+	_, id, ok := xs.ID().Lookup("id").BinaryOK()
+	if !ok {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// TxnNumber returns the number of the current or last transaction on the
+// session, or 0 if the underlying session does not expose it.
+func (ws *WrappedSession) TxnNumber() int64 {
+	xs, ok := ws.Session.(mongo.XSession)
+	if !ok {
+		return 0
+	}
+	cs := xs.ClientSession()
+	if cs == nil || cs.Server == nil {
+		return 0
+	}
+	return cs.TxnNumber
+}
+
 func (ws *WrappedSession) ClusterTime() bson.Raw {
 	return ws.Session.ClusterTime()
 }
 
+// AdvanceClusterTime advances the session's cluster time and records the
+// advance as an annotation on the session's active span.
 func (ws *WrappedSession) AdvanceClusterTime(br bson.Raw) error {
-	return ws.Session.AdvanceClusterTime(br)
+	before := clusterTimestamp(ws.Session.ClusterTime())
+	err := ws.Session.AdvanceClusterTime(br)
+	ws.annotateTimeAdvance("Advanced cluster time", before, clusterTimestamp(ws.Session.ClusterTime()), err)
+	return err
 }
 
 func (ws *WrappedSession) OperationTime() *primitive.Timestamp {
 	return ws.Session.OperationTime()
 }
 
+// AdvanceOperationTime advances the session's operation time and records the
+// advance as an annotation on the session's active span.
 func (ws *WrappedSession) AdvanceOperationTime(pt *primitive.Timestamp) error {
-	return ws.Session.AdvanceOperationTime(pt)
+	before := ws.Session.OperationTime()
+	err := ws.Session.AdvanceOperationTime(pt)
+	ws.annotateTimeAdvance("Advanced operation time", before, ws.Session.OperationTime(), err)
+	return err
+}
+
+// activeSpan returns the span of the transaction in progress, falling back
+// to the span the session was handed out under by UseSession.
+func (ws *WrappedSession) activeSpan() *trace.Span {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.txnSpan != nil {
+		return ws.txnSpan.span
+	}
+	if ws.ctx != nil {
+		return trace.FromContext(ws.ctx)
+	}
+	return nil
+}
+
+func (ws *WrappedSession) annotateTimeAdvance(msg string, before, after *primitive.Timestamp, err error) {
+	span := ws.activeSpan()
+	if span == nil {
+		return
+	}
+	attrs := []trace.Attribute{
+		trace.StringAttribute("from", formatTimestamp(before)),
+		trace.StringAttribute("to", formatTimestamp(after)),
+	}
+	if err != nil {
+		attrs = append(attrs, trace.StringAttribute("error", err.Error()))
+	}
+	span.Annotate(attrs, msg)
+}
+
+// ContextWithOperationTime returns ctx tagged with the session's operation
+// time. The tag travels with the rest of the OpenCensus tags, so services
+// that propagate tags (e.g. through ocgrpc) can hand it to a session of
+// their own with AdvanceOperationTimeFromContext and read their own writes.
+func (ws *WrappedSession) ContextWithOperationTime(ctx context.Context) context.Context {
+	pt := ws.Session.OperationTime()
+	if pt == nil {
+		return ctx
+	}
+	tctx, err := tag.New(ctx, tag.Upsert(keyOperationTime, formatTimestamp(pt)))
+	if err != nil {
+		return ctx
+	}
+	return tctx
+}
+
+// AdvanceOperationTimeFromContext advances the session's operation time to
+// the one carried by ctx, as set by ContextWithOperationTime. It is a no-op if
+// ctx carries no operation time.
+func (ws *WrappedSession) AdvanceOperationTimeFromContext(ctx context.Context) error {
+	pt, ok := OperationTimeFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	return ws.AdvanceOperationTime(pt)
+}
+
+// OperationTimeFromContext returns the operation time carried by ctx, as set
+// by WrappedSession.ContextWithOperationTime.
+func OperationTimeFromContext(ctx context.Context) (*primitive.Timestamp, bool) {
+	v, ok := tag.FromContext(ctx).Value(keyOperationTime)
+	if !ok {
+		return nil, false
+	}
+	return parseTimestamp(v)
+}
+
+func formatTimestamp(pt *primitive.Timestamp) string {
+	if pt == nil {
+		return ""
+	}
+	return strconv.FormatUint(uint64(pt.T), 10) + "." + strconv.FormatUint(uint64(pt.I), 10)
+}
+
+func parseTimestamp(s string) (*primitive.Timestamp, bool) {
+	dot := strings.IndexByte(s, '.')
+	if dot < 0 {
+		return nil, false
+	}
+	t, err := strconv.ParseUint(s[:dot], 10, 32)
+	if err != nil {
+		return nil, false
+	}
+	i, err := strconv.ParseUint(s[dot+1:], 10, 32)
+	if err != nil {
+		return nil, false
+	}
+	return &primitive.Timestamp{T: uint32(t), I: uint32(i)}, true
+}
+
+// clusterTimestamp extracts the timestamp from a $clusterTime document.
+func clusterTimestamp(ct bson.Raw) *primitive.Timestamp {
+	if ct == nil {
+		return nil
+	}
+	v, err := ct.LookupErr("$clusterTime", "clusterTime")
+	if err != nil {
+		return nil
+	}
+	t, i, ok := v.TimestampOK()
+	if !ok {
+		return nil
+	}
+	return &primitive.Timestamp{T: t, I: i}
 }
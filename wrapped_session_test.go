@@ -0,0 +1,320 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opencensus.io/trace"
+)
+
+// fakeSession satisfies mongo.Session without a server; only the
+// transaction state machine methods are implemented.
+type fakeSession struct {
+	mongo.Session
+	opTime *primitive.Timestamp
+}
+
+func (fs *fakeSession) StartTransaction(...*options.TransactionOptions) error { return nil }
+func (fs *fakeSession) CommitTransaction(context.Context) error               { return nil }
+func (fs *fakeSession) AbortTransaction(context.Context) error                { return nil }
+func (fs *fakeSession) EndSession(context.Context)                            {}
+func (fs *fakeSession) OperationTime() *primitive.Timestamp                   { return fs.opTime }
+func (fs *fakeSession) AdvanceOperationTime(pt *primitive.Timestamp) error {
+	fs.opTime = pt
+	return nil
+}
+
+// retryingSession is a fakeSession whose commits fail with commitErrs, in
+// order, before succeeding.
+type retryingSession struct {
+	fakeSession
+	commitErrs []error
+	commits    int
+}
+
+func (rs *retryingSession) CommitTransaction(context.Context) error {
+	rs.commits++
+	if len(rs.commitErrs) == 0 {
+		return nil
+	}
+	err := rs.commitErrs[0]
+	rs.commitErrs = rs.commitErrs[1:]
+	return err
+}
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (sr *spanRecorder) ExportSpan(sd *trace.SpanData) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	sr.spans = append(sr.spans, sd)
+}
+
+func (sr *spanRecorder) byName(name string) *trace.SpanData {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	for _, sd := range sr.spans {
+		if sd.Name == name {
+			return sd
+		}
+	}
+	return nil
+}
+
+func TestUnitTransactionSpanParentsOperations(t *testing.T) {
+	sr := new(spanRecorder)
+	trace.RegisterExporter(sr)
+	defer trace.UnregisterExporter(sr)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	ws := &WrappedSession{Session: new(fakeSession)}
+	sessCtx := ws.sessionContext(context.Background())
+	if g := sessionFromContext(sessCtx); g != ws {
+		t.Fatalf("sessionFromContext: Got %p Want %p", g, ws)
+	}
+	if err := sessCtx.StartTransaction(); err != nil {
+		t.Fatalf("StartTransaction: %v", err)
+	}
+
+	ctx, span := roundtripTrackingSpan(sessCtx, "a.b.c/D.Insert")
+	span.end(ctx)
+	if err := sessCtx.CommitTransaction(sessCtx); err != nil {
+		t.Fatalf("CommitTransaction: %v", err)
+	}
+
+	txn := sr.byName("go.mongodb.org/mongo-driver.Session.Transaction")
+	if txn == nil {
+		t.Fatal("No transaction span was exported")
+	}
+	if g, w := txn.Attributes["mongo.txn_outcome"], "committed"; g != w {
+		t.Errorf("Transaction outcome: Got %v Want %q", g, w)
+	}
+	for _, name := range []string{"a.b.c/D.Insert", "go.mongodb.org/mongo-driver.Session.CommitTransaction"} {
+		sd := sr.byName(name)
+		if sd == nil {
+			t.Errorf("No span named %q was exported", name)
+			continue
+		}
+		if g, w := sd.ParentSpanID, txn.SpanID; g != w {
+			t.Errorf("%s.ParentSpanID: Got %v Want %v", name, g, w)
+		}
+	}
+}
+
+func TestUnitTransactionSpanParentsOnCaller(t *testing.T) {
+	sr := new(spanRecorder)
+	trace.RegisterExporter(sr)
+	defer trace.UnregisterExporter(sr)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+	defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+	ctx, caller := trace.StartSpan(context.Background(), "caller")
+	defer caller.End()
+
+	// From the SessionContext, as in a UseSession callback.
+	ws := &WrappedSession{Session: new(fakeSession)}
+	sessCtx := ws.sessionContext(ctx)
+	if err := sessCtx.StartTransaction(); err != nil {
+		t.Fatalf("StartTransaction: %v", err)
+	}
+	if err := sessCtx.AbortTransaction(sessCtx); err != nil {
+		t.Fatalf("AbortTransaction: %v", err)
+	}
+	// From the session itself, for a session handed out with a context.
+	ws = &WrappedSession{Session: new(fakeSession), ctx: ctx}
+	if err := ws.StartTransaction(); err != nil {
+		t.Fatalf("StartTransaction: %v", err)
+	}
+	ws.EndSession(context.Background())
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	var outcomes []string
+	for _, sd := range sr.spans {
+		if sd.Name != "go.mongodb.org/mongo-driver.Session.Transaction" {
+			continue
+		}
+		if g, w := sd.ParentSpanID, caller.SpanContext().SpanID; g != w {
+			t.Errorf("Transaction.ParentSpanID: Got %v Want %v", g, w)
+		}
+		outcomes = append(outcomes, sd.Attributes["mongo.txn_outcome"].(string))
+	}
+	if g, w := strings.Join(outcomes, ","), "aborted,aborted"; g != w {
+		t.Errorf("Transaction outcomes: Got %q Want %q", g, w)
+	}
+}
+
+func TestUnitWithTransactionRetries(t *testing.T) {
+	transient := mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{transientTransactionError}}
+	unknown := mongo.CommandError{Code: 91, Name: "ShutdownInProgress", Labels: []string{unknownTransactionCommitResult}}
+
+	tests := []struct {
+		name       string
+		fnErrs     []error
+		commitErrs []error
+		// outcomes and reasons of the transaction spans, in order.
+		outcomes []string
+		reasons  []string
+		commits  int
+		// retriedCommits is the number of commits retried in the first
+		// transaction.
+		retriedCommits int
+	}{
+		{
+			name:     "transient callback error",
+			fnErrs:   []error{transient},
+			outcomes: []string{"aborted", "committed"},
+			reasons:  []string{"none", transientTransactionError},
+			commits:  1,
+		},
+		{
+			name:       "transient commit error",
+			commitErrs: []error{transient},
+			outcomes:   []string{"committed_failed", "committed"},
+			reasons:    []string{"none", transientTransactionError},
+			commits:    2,
+		},
+		{
+			name:           "unknown commit result",
+			commitErrs:     []error{unknown, unknown},
+			outcomes:       []string{"committed"},
+			reasons:        []string{"none"},
+			commits:        3,
+			retriedCommits: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := new(spanRecorder)
+			trace.RegisterExporter(sr)
+			defer trace.UnregisterExporter(sr)
+			trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+			defer trace.ApplyConfig(trace.Config{DefaultSampler: trace.ProbabilitySampler(1e-4)})
+
+			rs := &retryingSession{commitErrs: tt.commitErrs}
+			ws := &WrappedSession{Session: rs}
+			fnErrs := tt.fnErrs
+			res, err := ws.WithTransaction(context.Background(), func(mongo.SessionContext) (interface{}, error) {
+				if len(fnErrs) > 0 {
+					err := fnErrs[0]
+					fnErrs = fnErrs[1:]
+					return nil, err
+				}
+				return "done", nil
+			})
+			if err != nil || res != "done" {
+				t.Fatalf("WithTransaction: Got %v, %v Want done, nil", res, err)
+			}
+			if g, w := rs.commits, tt.commits; g != w {
+				t.Errorf("Commits: Got %d Want %d", g, w)
+			}
+
+			sr.mu.Lock()
+			defer sr.mu.Unlock()
+			var outcomes, reasons []string
+			var txns []*trace.SpanData
+			for _, sd := range sr.spans {
+				if sd.Name == "go.mongodb.org/mongo-driver.Session.Transaction" {
+					txns = append(txns, sd)
+					outcomes = append(outcomes, sd.Attributes["mongo.txn_outcome"].(string))
+					reasons = append(reasons, sd.Attributes["mongo.txn_retry_reason"].(string))
+				}
+			}
+			if g, w := strings.Join(outcomes, ","), strings.Join(tt.outcomes, ","); g != w {
+				t.Errorf("Transaction outcomes: Got %q Want %q", g, w)
+			}
+			if g, w := strings.Join(reasons, ","), strings.Join(tt.reasons, ","); g != w {
+				t.Errorf("Transaction retry reasons: Got %q Want %q", g, w)
+			}
+
+			// Every commit, retried or not, happens within a transaction span.
+			byID := make(map[trace.SpanID]*trace.SpanData)
+			for _, txn := range txns {
+				byID[txn.SpanID] = txn
+			}
+			commits := 0
+			for _, sd := range sr.spans {
+				if sd.Name != "go.mongodb.org/mongo-driver.Session.CommitTransaction" {
+					continue
+				}
+				commits++
+				if txn := byID[sd.ParentSpanID]; txn == nil || sd.EndTime.After(txn.EndTime) {
+					t.Errorf("CommitTransaction span is not within a transaction span")
+				}
+			}
+			if commits != tt.commits {
+				t.Errorf("CommitTransaction spans: Got %d Want %d", commits, tt.commits)
+			}
+			if g, w := len(txns[0].Annotations), tt.retriedCommits; g != w {
+				t.Errorf("Retrying commit annotations: Got %d Want %d", g, w)
+			}
+		})
+	}
+}
+
+func TestUnitOperationTimeThroughContext(t *testing.T) {
+	want := &primitive.Timestamp{T: 1571400000, I: 7}
+	writer := &WrappedSession{Session: &fakeSession{opTime: want}}
+	ctx := writer.ContextWithOperationTime(context.Background())
+
+	reader := &WrappedSession{Session: new(fakeSession)}
+	if err := reader.AdvanceOperationTimeFromContext(ctx); err != nil {
+		t.Fatalf("AdvanceOperationTimeFromContext: %v", err)
+	}
+	if g := reader.OperationTime(); g == nil || *g != *want {
+		t.Errorf("OperationTime: Got %v Want %v", g, want)
+	}
+
+	if _, ok := OperationTimeFromContext(context.Background()); ok {
+		t.Error("OperationTimeFromContext: expected no operation time in a bare context")
+	}
+}
+
+func TestUnitSessionTrackerReportsUnendedSessions(t *testing.T) {
+	st := NewSessionTracker()
+	wc := &WrappedClient{cfg: &config{sessionTracker: st}}
+
+	ended := wc.wrapSession(new(fakeSession), nil)
+	leaked := wc.wrapSession(new(fakeSession), nil)
+	ended.EndSession(context.Background())
+
+	live := st.Live()
+	if g, w := len(live), 1; g != w {
+		t.Fatalf("Live sessions: Got %d Want %d", g, w)
+	}
+	if !strings.Contains(live[0].Stack, "TestUnitSessionTrackerReportsUnendedSessions") {
+		t.Errorf("Stack does not name the creating function:\n%s", live[0].Stack)
+	}
+	if g := st.Older(time.Hour); len(g) != 0 {
+		t.Errorf("Older(1h): Got %d sessions Want 0", len(g))
+	}
+
+	leaked.EndSession(context.Background())
+	if g := st.Live(); len(g) != 0 {
+		t.Errorf("Live sessions after EndSession: Got %d Want 0", len(g))
+	}
+}
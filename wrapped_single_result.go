@@ -0,0 +1,65 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// SingleResult is the set of operations of a WrappedSingleResult. It is also
+// implemented by *mongo.SingleResult.
+type SingleResult interface {
+	Decode(v interface{}) error
+	DecodeBytes() (bson.Raw, error)
+	Err() error
+}
+
+var _ SingleResult = (*mongo.SingleResult)(nil)
+
+// WrappedSingleResult is the result of WrappedCollection.FindOneWrapped and
+// the FindOneAnd*Wrapped methods.
+type WrappedSingleResult struct {
+	sr SingleResult
+}
+
+var _ SingleResult = (*WrappedSingleResult)(nil)
+
+// NewSingleResult wraps sr, typically a fake, so that it can be returned
+// from a Collection or CollectionBackend implementation used in tests.
+func NewSingleResult(sr SingleResult) *WrappedSingleResult { return &WrappedSingleResult{sr: sr} }
+
+func (wsr *WrappedSingleResult) Decode(v interface{}) error     { return wsr.sr.Decode(v) }
+func (wsr *WrappedSingleResult) DecodeBytes() (bson.Raw, error) { return wsr.sr.DecodeBytes() }
+func (wsr *WrappedSingleResult) Err() error                     { return wsr.sr.Err() }
+
+// SingleResult returns the underlying driver result, or nil if the result
+// does not come from the driver.
+func (wsr *WrappedSingleResult) SingleResult() *mongo.SingleResult {
+	sr, _ := wsr.sr.(*mongo.SingleResult)
+	return sr
+}
+
+// driverSingleResult returns the driver result behind wsr for the methods
+// that keep the signature of the driver. The driver offers no way to build a
+// SingleResult, so results of other backends, and of operations failed by an
+// interceptor, are replaced by an empty one: its Err reports ErrNoDocuments
+// and Decode fails.
+func driverSingleResult(wsr *WrappedSingleResult) *mongo.SingleResult {
+	if sr := wsr.SingleResult(); sr != nil {
+		return sr
+	}
+	return new(mongo.SingleResult)
+}
@@ -0,0 +1,69 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestSingleResults(t *testing.T) {
+	errDenied := errors.New("denied")
+	deny := func(ctx context.Context, op *mongowrapper.Operation, invoke mongowrapper.Invoker) error {
+		if op.ShortMethod() == "Collection.FindOneAndDelete" {
+			return errDenied
+		}
+		return invoke(ctx, op)
+	}
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("c"), deny)
+	ctx := context.Background()
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 1, "n": 1}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	// The driver typed methods only return the results of the driver;
+	// others come back empty.
+	var doc struct{ N int }
+	if err := coll.FindOne(ctx, bson.M{"_id": 1}).Err(); err != mongo.ErrNoDocuments {
+		t.Errorf("FindOne: got %v, want an empty result", err)
+	}
+	if err := coll.FindOneAndUpdate(ctx, bson.M{"_id": 1}, bson.M{"$inc": bson.M{"n": 1}}).Err(); err != mongo.ErrNoDocuments {
+		t.Errorf("FindOneAndUpdate: got %v, want an empty result", err)
+	}
+	if err := coll.FindOneAndDelete(ctx, bson.M{"_id": 1}).Decode(&doc); err == nil {
+		t.Errorf("FindOneAndDelete: got %+v, want an empty result", doc)
+	}
+	if err := coll.FindOneWrapped(ctx, bson.M{"_id": 2}).Err(); err != mongo.ErrNoDocuments {
+		t.Errorf("FindOneWrapped of a missing document: got %v, want ErrNoDocuments", err)
+	}
+
+	raw, err := coll.FindOneWrapped(ctx, bson.M{"_id": 1}).DecodeBytes()
+	if err != nil {
+		t.Fatalf("FindOneWrapped: %v", err)
+	}
+	if n, _ := raw.Lookup("n").Int32OK(); n != 2 {
+		t.Errorf("FindOneWrapped: got n %d, want 2", n)
+	}
+	if err := coll.FindOneAndDeleteWrapped(ctx, bson.M{"_id": 1}).Err(); err != errDenied {
+		t.Errorf("FindOneAndDeleteWrapped: got %v, want the interceptor error", err)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+)
+
+// UnboundedWriteError is returned for DeleteMany, UpdateMany and Drop calls,
+// and bulk writes holding such models, rejected by the write guard.
+type UnboundedWriteError struct {
+	Method    string
+	Namespace string
+	// Rule is "empty_filter", "drop" or the name of the WriteGuardRule that
+	// rejected the call.
+	Rule string
+}
+
+func (e *UnboundedWriteError) Error() string {
+	return fmt.Sprintf("mongowrapper: %s on %s rejected by the write guard (%s); use AllowUnboundedWrites to permit it",
+		e.Method, e.Namespace, e.Rule)
+}
+
+// WriteGuardRule rejects the DeleteMany and UpdateMany calls it matches, in
+// addition to those with an empty filter. The DeleteMany and UpdateMany
+// models of bulk writes are matched as calls of their own.
+type WriteGuardRule struct {
+	Name  string
+	Match func(op *Operation) bool
+}
+
+type allowUnboundedKey struct{}
+
+// AllowUnboundedWrites returns a copy of ctx with which the write guard lets
+// every DeleteMany, UpdateMany and Drop call through.
+func AllowUnboundedWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, allowUnboundedKey{}, true)
+}
+
+// SetWriteGuard makes the collections of the client reject DeleteMany and
+// UpdateMany calls with an empty filter or matching one of rules, bulk
+// writes holding such DeleteMany or UpdateMany models, and Drop calls,
+// unless their context comes from AllowUnboundedWrites. It must be called
+// before the client is used.
+func (wc *WrappedClient) SetWriteGuard(rules ...WriteGuardRule) {
+	wc.AddInterceptors(WriteGuardInterceptor(rules...))
+}
+
+// WriteGuardInterceptor returns the Interceptor behind SetWriteGuard, for
+// use with NewCollection. Rejections fail with an *UnboundedWriteError and
+// are counted in the mongo/client/write_guard/rejections view.
+//
+// The guard checks the operation as the caller issued it, whatever its
+// place in the chain relative to the tenancy interceptor, so that a filter
+// scoped to the tenant still counts as empty.
+func WriteGuardInterceptor(rules ...WriteGuardRule) Interceptor {
+	return func(ctx context.Context, op *Operation, invoke Invoker) error {
+		if allowed, _ := ctx.Value(allowUnboundedKey{}).(bool); allowed {
+			return invoke(ctx, op)
+		}
+
+		issued := issuedOperation(ctx, op)
+		var rule string
+		switch issued.ShortMethod() {
+		case "Collection.Drop":
+			rule = "drop"
+		case "Collection.DeleteMany", "Collection.UpdateMany":
+			rule = guardRule(issued, rules)
+		case "Collection.BulkWrite":
+			for _, m := range issued.Models {
+				kind, filter, update := writeModelArgs(m)
+				if kind != "DeleteMany" && kind != "UpdateMany" {
+					continue
+				}
+				model := *issued
+				model.Method = methodPrefix + "Collection." + kind
+				model.Filter, model.Update, model.Models = filter, update, nil
+				if rule = guardRule(&model, rules); rule != "" {
+					break
+				}
+			}
+		}
+		if rule == "" {
+			return invoke(ctx, op)
+		}
+
+		tctx, _ := tag.New(ctx,
+			tag.Upsert(keyMethod, op.Method),
+			tag.Upsert(keyNamespace, op.Namespace()),
+			tag.Upsert(keyGuardRule, rule),
+		)
+		stats.Record(tctx, mGuardRejections.M(1))
+		return &UnboundedWriteError{Method: op.ShortMethod(), Namespace: op.Namespace(), Rule: rule}
+	}
+}
+
+// guardRule returns the rule rejecting the DeleteMany or UpdateMany op, or
+// "" if none does.
+func guardRule(op *Operation, rules []WriteGuardRule) string {
+	if isEmptyFilter(op.Filter) {
+		return "empty_filter"
+	}
+	for _, r := range rules {
+		if r.Match(op) {
+			return r.Name
+		}
+	}
+	return ""
+}
+
+// isEmptyFilter reports whether filter matches every document.
+func isEmptyFilter(filter interface{}) bool {
+	if filter == nil {
+		return true
+	}
+	raw, err := bson.Marshal(filter)
+	if err != nil {
+		// Let the driver report the invalid filter.
+		return false
+	}
+	elems, err := bson.Raw(raw).Elements()
+	return err == nil && len(elems) == 0
+}
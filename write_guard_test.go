@@ -0,0 +1,136 @@
+// Copyright 2018, OpenCensus Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongowrapper_test
+
+import (
+	"context"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opencensus.io/stats/view"
+
+	mongowrapper "github.com/opencensus-integrations/gomongowrapper"
+	"github.com/opencensus-integrations/gomongowrapper/mongowrappertest"
+)
+
+func TestWriteGuard(t *testing.T) {
+	rec, err := mongowrappertest.StartRecorder()
+	if err != nil {
+		t.Fatalf("StartRecorder: %v", err)
+	}
+	defer rec.Stop()
+
+	onlyStatus := mongowrapper.WriteGuardRule{
+		Name: "status_only",
+		Match: func(op *mongowrapper.Operation) bool {
+			f, ok := op.Filter.(bson.M)
+			_, hasStatus := f["status"]
+			return ok && len(f) == 1 && hasStatus
+		},
+	}
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("orders"),
+		mongowrapper.WriteGuardInterceptor(onlyStatus))
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := coll.InsertOne(ctx, bson.M{"_id": i, "status": "open"}); err != nil {
+			t.Fatalf("InsertOne: %v", err)
+		}
+	}
+
+	for _, tt := range []struct {
+		name string
+		call func(context.Context) error
+		rule string
+	}{
+		{"DeleteMany empty bson.M", func(ctx context.Context) error {
+			_, err := coll.DeleteMany(ctx, bson.M{})
+			return err
+		}, "empty_filter"},
+		{"UpdateMany nil filter", func(ctx context.Context) error {
+			_, err := coll.UpdateMany(ctx, nil, bson.M{"$set": bson.M{"status": "closed"}})
+			return err
+		}, "empty_filter"},
+		{"DeleteMany matching a rule", func(ctx context.Context) error {
+			_, err := coll.DeleteMany(ctx, bson.M{"status": "open"})
+			return err
+		}, "status_only"},
+		{"Drop", func(ctx context.Context) error { return coll.Drop(ctx) }, "drop"},
+		{"BulkWrite with an empty DeleteMany", func(ctx context.Context) error {
+			_, err := coll.BulkWrite(ctx, []mongo.WriteModel{
+				mongo.NewDeleteOneModel().SetFilter(bson.M{}),
+				mongo.NewDeleteManyModel().SetFilter(bson.M{}),
+			})
+			return err
+		}, "empty_filter"},
+		{"BulkWrite with an UpdateMany matching a rule", func(ctx context.Context) error {
+			_, err := coll.BulkWrite(ctx, []mongo.WriteModel{
+				mongo.NewUpdateManyModel().SetFilter(bson.M{"status": "open"}).SetUpdate(bson.M{"$set": bson.M{"status": "closed"}}),
+			})
+			return err
+		}, "status_only"},
+	} {
+		err := tt.call(ctx)
+		uwe, ok := err.(*mongowrapper.UnboundedWriteError)
+		if !ok || uwe.Rule != tt.rule || uwe.Namespace != "db.orders" {
+			t.Errorf("%s: got %v, want an UnboundedWriteError for rule %q", tt.name, err, tt.rule)
+		}
+	}
+	if n, _ := coll.CountDocuments(ctx, bson.M{}); n != 3 {
+		t.Fatalf("rejected writes changed the collection: %d documents left, want 3", n)
+	}
+
+	rows, err := rec.Rows("mongo/client/write_guard/rejections")
+	if err != nil {
+		t.Fatalf("Rows: %v", err)
+	}
+	var rejections int64
+	for _, row := range rows {
+		rejections += row.Data.(*view.CountData).Value
+	}
+	if rejections != 6 {
+		t.Errorf("rejections: got %d, want 6", rejections)
+	}
+
+	// Bounded writes and opted-in contexts go through.
+	if _, err := coll.DeleteMany(ctx, bson.M{"_id": 0, "status": "open"}); err != nil {
+		t.Errorf("DeleteMany with a bounded filter: %v", err)
+	}
+	if _, err := coll.DeleteMany(mongowrapper.AllowUnboundedWrites(ctx), bson.M{}); err != nil {
+		t.Errorf("DeleteMany with AllowUnboundedWrites: %v", err)
+	}
+	if n, _ := coll.CountDocuments(ctx, bson.M{}); n != 0 {
+		t.Errorf("CountDocuments: got %d, want 0", n)
+	}
+}
+
+func TestWriteGuardAfterTenancy(t *testing.T) {
+	coll := mongowrapper.NewCollection("db", mongowrappertest.NewCollection("orders"),
+		mongowrapper.TenancyInterceptor("tenant"), mongowrapper.WriteGuardInterceptor())
+	ctx := mongowrapper.ContextWithTenant(context.Background(), "acme")
+	if _, err := coll.InsertOne(ctx, bson.M{"_id": 1}); err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	// Scoped to the tenant, the filter is no longer empty, but the guard
+	// checks the filter as the caller issued it.
+	_, err := coll.DeleteMany(ctx, bson.M{})
+	if uwe, ok := err.(*mongowrapper.UnboundedWriteError); !ok || uwe.Rule != "empty_filter" {
+		t.Fatalf("DeleteMany: got %v, want an UnboundedWriteError for an empty filter", err)
+	}
+	if n, _ := coll.CountDocuments(ctx, bson.M{}); n != 1 {
+		t.Errorf("CountDocuments: got %d, want 1", n)
+	}
+}